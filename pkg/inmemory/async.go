@@ -0,0 +1,193 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Backpressure policies of an AsyncListener, applied when the queue of a shard is full.
+const (
+	// Block waits until the queue has room, stalling the stream as a synchronous listener does.
+	Block = "block"
+	// Drop discards the event and reports it to AsyncOptions.OnDrop.
+	Drop = "drop"
+	// Spill keeps the event in memory beyond the capacity of the queue.
+	Spill = "spill"
+)
+
+// AsyncOptions configures an AsyncListener.
+type AsyncOptions struct {
+	Shards   int    // number of queues and workers, 1 by default; events of an entity always use the same shard
+	Capacity int    // capacity of the queue of each shard, 1024 by default
+	Policy   string // Block (default), Drop or Spill
+	// OnPanic, if non-nil, is called with the value of a recovered panic of the listener.
+	OnPanic func(ctx context.Context, id string, recovered any)
+	// OnDrop, if non-nil, is called with the ID of the entity of an event dropped by the Drop policy.
+	OnDrop func(ctx context.Context, id string)
+}
+
+// asyncEvent is a queued event: a call of the wrapped listener.
+type asyncEvent struct {
+	ctx  context.Context
+	id   string
+	call func(ctx context.Context)
+}
+
+type asyncShard struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []asyncEvent
+	closed bool
+}
+
+// AsyncListener runs a StreamEventListener on bounded queues, so a slow or failing listener
+// does not stall or crash the projection. Events of an entity are dispatched in order, by the worker
+// of the shard of its ID; panics of the listener are recovered and reported. The entities of the events
+// are copied when they are queued, so the worker sees them as they were at the event.
+type AsyncListener[T d] struct {
+	listener StreamEventListener[T]
+	opts     AsyncOptions
+	shards   []*asyncShard
+	wg       sync.WaitGroup
+}
+
+// NewAsyncListener wraps the listener and starts the workers of its shards.
+// An error is returned for an unknown Policy.
+func NewAsyncListener[T d](listener StreamEventListener[T], opts AsyncOptions) (*AsyncListener[T], error) {
+	if opts.Shards <= 0 {
+		opts.Shards = 1
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 1024
+	}
+	switch opts.Policy {
+	case "":
+		opts.Policy = Block
+	case Block, Drop, Spill:
+	default:
+		return nil, fmt.Errorf("async listener: unknown policy %q", opts.Policy)
+	}
+	a := &AsyncListener[T]{
+		listener: listener,
+		opts:     opts,
+		shards:   make([]*asyncShard, opts.Shards),
+	}
+	for i := range a.shards {
+		s := &asyncShard{}
+		s.cond = sync.NewCond(&s.mu)
+		a.shards[i] = s
+		a.wg.Add(1)
+		go a.work(s)
+	}
+	return a, nil
+}
+
+// Add ...
+func (a *AsyncListener[T]) Add(ctx context.Context, v T) {
+	// The entity is the one stored in the cache, which later events change in place: the worker gets a copy.
+	v = copyOf(ctx, v)
+	a.enqueue(ctx, v.ID(), func(ctx context.Context) {
+		a.listener.Add(ctx, v)
+	})
+}
+
+// Update ...
+func (a *AsyncListener[T]) Update(ctx context.Context, _id primitive.ObjectID, updatedFields T, removedFields []string) {
+	updatedFields = copyOf(ctx, updatedFields)
+	removedFields = append([]string(nil), removedFields...)
+	a.enqueue(ctx, _id.Hex(), func(ctx context.Context) {
+		a.listener.Update(ctx, _id, updatedFields, removedFields)
+	})
+}
+
+// Delete ...
+func (a *AsyncListener[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
+	a.enqueue(ctx, _id.Hex(), func(ctx context.Context) {
+		a.listener.Delete(ctx, _id)
+	})
+}
+
+// Close stops accepting events and waits until the queued ones are dispatched.
+func (a *AsyncListener[T]) Close() {
+	for _, s := range a.shards {
+		s.mu.Lock()
+		s.closed = true
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+	a.wg.Wait()
+}
+
+func (a *AsyncListener[T]) shard(id string) *asyncShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return a.shards[h.Sum32()%uint32(len(a.shards))]
+}
+
+func (a *AsyncListener[T]) enqueue(ctx context.Context, id string, call func(ctx context.Context)) {
+	if !a.push(ctx, id, call) {
+		// OnDrop is called outside of the lock of the shard, so it may be slow or enqueue events itself.
+		if a.opts.OnDrop != nil {
+			a.opts.OnDrop(ctx, id)
+		}
+		zerolog.Ctx(ctx).Warn().Str("id", id).Msg("async listener: queue is full, event dropped")
+	}
+}
+
+// push queues the event in its shard. It reports false if the event is dropped by the Drop policy.
+func (a *AsyncListener[T]) push(ctx context.Context, id string, call func(ctx context.Context)) bool {
+	s := a.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed && len(s.queue) >= a.opts.Capacity && a.opts.Policy == Block {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return true
+	}
+	if len(s.queue) >= a.opts.Capacity && a.opts.Policy == Drop {
+		return false
+	}
+	s.queue = append(s.queue, asyncEvent{ctx: ctx, id: id, call: call})
+	s.cond.Broadcast()
+	return true
+}
+
+func (a *AsyncListener[T]) work(s *asyncShard) {
+	defer a.wg.Done()
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		e := s.queue[0]
+		s.queue[0] = asyncEvent{}
+		s.queue = s.queue[1:]
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		a.dispatch(e)
+	}
+}
+
+func (a *AsyncListener[T]) dispatch(e asyncEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			zerolog.Ctx(e.ctx).Error().Str("id", e.id).Str("panic", fmt.Sprint(r)).Bytes("stack", debug.Stack()).
+				Msg("async listener: recovered panic")
+			if a.opts.OnPanic != nil {
+				a.opts.OnPanic(e.ctx, e.id, r)
+			}
+		}
+	}()
+	e.call(e.ctx)
+}
@@ -0,0 +1,110 @@
+package inmemory_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+)
+
+func TestAsyncListener(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu      sync.Mutex
+		updated = map[string][]string{}
+		panics  int
+	)
+	l, err := inmemory.NewAsyncListener[*Image](inmemory.NewUpdateCallbackListener[*Image](
+		func(ctx context.Context, id string, updatedFields *Image, removedFields []string) {
+			if updatedFields.Name == nil {
+				panic("no name")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			updated[id] = append(updated[id], *updatedFields.Name)
+		},
+	), inmemory.AsyncOptions{
+		Shards:   4,
+		Capacity: 2,
+		OnPanic: func(ctx context.Context, id string, recovered any) {
+			mu.Lock()
+			defer mu.Unlock()
+			panics++
+		},
+	})
+	assert.NoError(t, err)
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	names := []string{"a", "b", "c", "d", "e"}
+	for k := range names {
+		for _, id := range ids {
+			l.Update(ctx, id, &Image{Name: &names[k]}, nil)
+		}
+	}
+	l.Update(ctx, ids[0], &Image{}, nil)
+	l.Close()
+	for _, id := range ids {
+		assert.Equal(t, names, updated[id.Hex()])
+	}
+	assert.Equal(t, 1, panics)
+}
+
+func TestAsyncListener_Drop(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	var dropped []string
+	l, err := inmemory.NewAsyncListener[*Image](inmemory.NewDeleteCallbackListener[*Image](
+		func(ctx context.Context, id string) {
+			<-release
+		},
+	), inmemory.AsyncOptions{
+		Capacity: 1,
+		Policy:   inmemory.Drop,
+		OnDrop: func(ctx context.Context, id string) {
+			dropped = append(dropped, id)
+		},
+	})
+	assert.NoError(t, err)
+	id := primitive.NewObjectID()
+	// the first event is taken by the worker or queued, then the queue is full
+	for i := 0; i < 3; i++ {
+		l.Delete(ctx, id)
+	}
+	close(release)
+	l.Close()
+	assert.NotEmpty(t, dropped)
+}
+
+func TestAsyncListener_Policy(t *testing.T) {
+	_, err := inmemory.NewAsyncListener[*Image](inmemory.NewDeleteCallbackListener[*Image](
+		func(ctx context.Context, id string) {},
+	), inmemory.AsyncOptions{Policy: "block-all"})
+	assert.Error(t, err)
+}
+
+func TestAsyncListener_Copy(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Image](nil, nil, nil)
+	release := make(chan struct{})
+	var added string
+	l, err := inmemory.NewAsyncListener[*Image](inmemory.NewAddCallbackListener[*Image](
+		func(ctx context.Context, v *Image) {
+			<-release
+			added = *v.Name
+		},
+	), inmemory.AsyncOptions{})
+	assert.NoError(t, err)
+	c.EventListener.AddListener(l, false)
+
+	first, second := "first", "second"
+	img := &Image{Name: &first}
+	c.EventListener.Add(ctx, img)
+	// the cached entity is changed in place while the event is queued
+	c.EventListener.UpdateFields(ctx, img.Id, &Image{Name: &second}, []string{"name"}, nil)
+	close(release)
+	l.Close()
+	assert.Equal(t, first, added)
+}
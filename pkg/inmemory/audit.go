@@ -0,0 +1,251 @@
+package inmemory
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditMeta describes who made a write and in which request. It is attached to the write context
+// with WithAuditMeta and recorded by the audit trail of the projection (see Audit).
+type AuditMeta struct {
+	Actor     string            `bson:"actor,omitempty"`
+	RequestID string            `bson:"requestId,omitempty"`
+	Metadata  map[string]string `bson:"metadata,omitempty"`
+}
+
+type auditMetaKey struct{}
+
+// WithAuditMeta returns a context carrying the audit metadata of the writes made with it.
+func WithAuditMeta(ctx context.Context, meta AuditMeta) context.Context {
+	return context.WithValue(ctx, auditMetaKey{}, meta)
+}
+
+// AuditMetaFromContext returns the audit metadata of the context.
+func AuditMetaFromContext(ctx context.Context) (meta AuditMeta, ok bool) {
+	meta, ok = ctx.Value(auditMetaKey{}).(AuditMeta)
+	return
+}
+
+// FieldChange is a changed field of an audit record: its dotted bson path with the old and new values.
+// Old is nil for an added field and New is nil for a removed one.
+type FieldChange struct {
+	Field string `bson:"field"`
+	Old   any    `bson:"old"`
+	New   any    `bson:"new"`
+}
+
+// AuditRecord is an entry of the audit trail.
+type AuditRecord struct {
+	Collection string        `bson:"collection"`
+	EntityID   string        `bson:"entityId"`
+	Operation  string        `bson:"operation"` // insert, update or delete (see mongo operation types)
+	Changes    []FieldChange `bson:"changes"`
+	AuditMeta  `bson:",inline"`
+	At         time.Time `bson:"at"`
+}
+
+// AuditSink stores audit records. Record is called synchronously on the path of the change events
+// of the projection, so a slow sink delays the projection: it must be fast, or hand the records over
+// to a queue of its own (e.g. a buffered channel drained by a goroutine).
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) (err error)
+}
+
+// AuditSinkFunc is an AuditSink calling a function.
+type AuditSinkFunc func(ctx context.Context, record AuditRecord) (err error)
+
+// Record ...
+func (f AuditSinkFunc) Record(ctx context.Context, record AuditRecord) error {
+	return f(ctx, record)
+}
+
+// AuditCollection is an AuditSink inserting the records into a MongoDB collection.
+type AuditCollection struct {
+	deps       MongoDeps
+	collection string
+}
+
+// NewAuditCollection creates an AuditSink inserting the records into the collection.
+func NewAuditCollection(deps MongoDeps, collection string) *AuditCollection {
+	return &AuditCollection{deps: deps, collection: collection}
+}
+
+// Record ...
+func (s *AuditCollection) Record(ctx context.Context, record AuditRecord) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.deps.ConnectionTimeout)
+	defer cancel()
+	_, err = s.deps.Client.Database(s.deps.Db).Collection(s.collection).InsertOne(ctx, record)
+	return
+}
+
+// Audit is a ChangeListener which records an audit trail of the changes of a projection:
+// a field-level diff between the old state of an entity, taken from the cache before the change,
+// and its new state after it. The audit metadata is taken from the context of the event or,
+// for writes awaited by the InMemory of the projection (Await* methods), from the context of the write.
+// It is registered with Entity.Audit; an Audit belongs to the projection of a single collection.
+type Audit[T d] struct {
+	sink       AuditSink
+	collection string
+	mu         sync.Mutex
+	pending    map[string][]AuditMeta // entity ID -> metadata of the writes awaiting their events
+}
+
+// NewAudit creates an audit trail of the changes of the collection writing to the sink.
+func NewAudit[T d](collection string, sink AuditSink) *Audit[T] {
+	return &Audit[T]{
+		sink:       sink,
+		collection: collection,
+		pending:    map[string][]AuditMeta{},
+	}
+}
+
+// track records the metadata of the write context for the next events of the entities.
+// The returned function forgets it, when the write fails.
+func (a *Audit[T]) track(ctx context.Context, ids ...string) (untrack func()) {
+	meta, ok := AuditMetaFromContext(ctx)
+	if !ok {
+		return func() {}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, id := range ids {
+		a.pending[id] = append(a.pending[id], meta)
+	}
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for _, id := range ids {
+			if n := len(a.pending[id]); n > 0 {
+				a.pending[id] = a.pending[id][:n-1]
+			}
+			if len(a.pending[id]) == 0 {
+				delete(a.pending, id)
+			}
+		}
+	}
+}
+
+// meta returns the metadata of the event: from its context, otherwise from the oldest tracked write.
+func (a *Audit[T]) meta(ctx context.Context, id string) (meta AuditMeta) {
+	a.mu.Lock()
+	tracked := a.pending[id]
+	if len(tracked) > 0 {
+		meta = tracked[0]
+		if len(tracked) == 1 {
+			delete(a.pending, id)
+		} else {
+			a.pending[id] = tracked[1:]
+		}
+	}
+	a.mu.Unlock()
+	if m, ok := AuditMetaFromContext(ctx); ok {
+		meta = m
+	}
+	return
+}
+
+// Change ...
+func (a *Audit[T]) Change(ctx context.Context, change Change[T]) {
+	record := AuditRecord{
+		Collection: a.collection,
+		EntityID:   change.ID,
+		AuditMeta:  a.meta(ctx, change.ID),
+		At:         time.Now().UTC(),
+	}
+	var before, after bson.M
+	if change.HasBefore {
+		before = auditDoc(ctx, change.Before)
+	}
+	if change.HasAfter {
+		after = auditDoc(ctx, change.After)
+	}
+	switch {
+	case !change.HasBefore:
+		record.Operation = "insert"
+	case !change.HasAfter:
+		record.Operation = "delete"
+	default:
+		record.Operation = "update"
+	}
+	record.Changes = diffDocs("", before, after, nil)
+	if record.Operation == "update" && len(record.Changes) == 0 {
+		return
+	}
+	if err := a.sink.Record(ctx, record); err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("collection", a.collection).Str("id", change.ID).Msg("audit: record change")
+	}
+}
+
+func auditDoc(ctx context.Context, v any) (doc bson.M) {
+	b, err := bson.Marshal(v)
+	if err == nil {
+		err = bson.Unmarshal(b, &doc)
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("audit: encode entity")
+	}
+	return
+}
+
+// diffDocs appends the changes between the documents, recursing into nested documents, sorted by path.
+func diffDocs(prefix string, before, after bson.M, changes []FieldChange) []FieldChange {
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "version" {
+			continue
+		}
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		o, n := before[k], after[k]
+		om, oDoc := asDoc(o)
+		nm, nDoc := asDoc(n)
+		if oDoc && nDoc {
+			changes = diffDocs(path, om, nm, changes)
+			continue
+		}
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, FieldChange{Field: path, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+func asDoc(v any) (bson.M, bool) {
+	switch d := v.(type) {
+	case bson.M:
+		return d, true
+	case primitive.D:
+		m := make(bson.M, len(d))
+		for _, e := range d {
+			m[e.Key] = e.Value
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// track records the audit metadata of the write context for the events of the entities, if the projection has an audit trail.
+func (p *inMemory[T]) track(ctx context.Context, ids ...string) (untrack func()) {
+	if p.audit == nil {
+		return func() {}
+	}
+	return p.audit.track(ctx, ids...)
+}
@@ -0,0 +1,54 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	c := NewCacheWithEventListener[*Image](nil, nil, nil)
+	var records []AuditRecord
+	a := NewAudit[*Image]("images", AuditSinkFunc(func(ctx context.Context, record AuditRecord) error {
+		records = append(records, record)
+		return nil
+	}))
+	c.EventListener.AddChangeListener(a)
+	im := &inMemory[*Image]{CacheWithEventListener: c, audit: a}
+
+	name, changed, png := "name", "changed", "png"
+	img := &Image{Name: &name}
+	c.EventListener.Add(ctx, img)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "insert", records[0].Operation)
+	assert.Equal(t, "images", records[0].Collection)
+	assert.Contains(t, records[0].Changes, FieldChange{Field: "name", New: name})
+
+	// the metadata of the write context is attached to the event of the entity
+	meta := AuditMeta{Actor: "alice", RequestID: "r1"}
+	im.track(WithAuditMeta(ctx, meta), img.ID())
+	c.EventListener.Update(ctx, img.Id, &Image{Name: &changed, Mime: &png}, nil)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "update", records[1].Operation)
+	assert.Equal(t, meta, records[1].AuditMeta)
+	assert.Equal(t, []FieldChange{
+		{Field: "mime", New: png},
+		{Field: "name", Old: name, New: changed},
+	}, records[1].Changes)
+
+	// a failed write is forgotten
+	untrack := im.track(WithAuditMeta(ctx, meta), img.ID())
+	untrack()
+	c.EventListener.Update(ctx, img.Id, &Image{Name: &name}, nil)
+	assert.Equal(t, AuditMeta{}, records[2].AuditMeta)
+
+	// an update which changes nothing is not recorded
+	c.EventListener.Update(ctx, img.Id, &Image{}, nil)
+	assert.Len(t, records, 3)
+
+	c.EventListener.Delete(ctx, img.Id)
+	assert.Equal(t, "delete", records[3].Operation)
+	assert.Contains(t, records[3].Changes, FieldChange{Field: "name", Old: name})
+}
@@ -6,7 +6,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	mng "go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -32,7 +34,16 @@ type d interface {
 // It extends StreamEventListener with the ability to add additional listeners.
 type EventListener[T d] interface {
 	StreamEventListener[T]
+	UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string)
+	Replace(ctx context.Context, v T)
+	ReplaceWithPreImage(ctx context.Context, before, v T)
+	DeleteWithPreImage(ctx context.Context, _id primitive.ObjectID, before T)
+	Patch(ctx context.Context, _id primitive.ObjectID, patch *mongo.Patch) (applied bool)
+	Clear(ctx context.Context)
 	AddListener(listener StreamEventListener[T], before bool) (idx int)
+	AddChangeListener(listener ChangeListener[T])
+	OnFieldChange(path string, callback FieldChangeCallback) (unsubscribe func())
+	Subscribe(ctx context.Context, match func(v T) bool, callback func(ctx context.Context, event QueryEvent[T])) (snapshot []T, unsubscribe func())
 }
 
 // InverseIndex provides an index that maps field values to lists of entity IDs.
@@ -78,18 +89,68 @@ type MongoDeps struct {
 // WarmupFilter, if non-nil, restricts the initial full sync (Searcher.FindWithFilter).
 // Use e.g. bson.M{"deleted": bson.M{"$ne": true}} to skip soft-deleted documents and shorten startup.
 // Nil means the entire collection is loaded (same as before).
+// WarmupFilter only affects the initial load; use Filter to keep the projection restricted afterwards.
+//
+// Filter, if non-nil, is a projection predicate: it restricts the initial load and is evaluated
+// on every Change Stream event, so documents that stop matching are evicted and documents
+// that start matching are added. A document which is not cached can only be checked against Match
+// from its full document: an update event without a post-image (see FullDocument) which changes a field
+// of Filter.BSON is followed by a lookup of the document in MongoDB on the Stream goroutine. With a BSON filter
+// whose fields are unknown ($expr, $where), every update of such a document is looked up.
+//
+// StreamFilter, if non-nil, narrows the Change Stream events of the collection on the server side
+// when the stream supports it (see mongo.Stream.SetWatcher and mongo.Stream.SetClient).
+//
+// OnCollectionEvent, if non-nil, is called after a drop, rename, dropDatabase or invalidate event
+// of the collection has cleared the projection (e.g. to call InMemory.Resync).
+//
+// FullDocument and PreImages select the document images applied from Change Stream events (see mongo.Images):
+// FullDocument applies post-images of updates as full document swaps,
+// PreImages gives change listeners the exact old entity.
+//
+// SoftDelete enables the soft-delete mode: AwaitDelete sets deleted=true instead of removing the document,
+// soft-deleted documents are kept out of the cache and indexes and are read with the IncludeDeleted variants,
+// Restore undeletes them and Purge removes them from MongoDB.
+//
+// Hooks are called before writes are sent to MongoDB, to validate or mutate them (see mongo.Hooks);
+// BeforeListeners are called only for the resulting change events.
+//
+// Refs registers the projection in a registry of projections which enforces the references declared
+// by the ref tags of T (see mongo.RefField): the same Refs is passed to all the projections involved.
+//
+// Async, if non-nil, runs each of the AfterListeners on its own queues (see AsyncListener),
+// so a slow or panicking listener does not stall or crash the projection. Their workers are stopped
+// by InMemory.Close; NewInMemory fails for an unknown Policy.
+//
+// Audit, if non-nil, records an audit trail of the changes of the projection (see Audit); it is created
+// with the collection of the projection and is not shared with other projections.
+//
+// Fields, if non-empty, lists the top-level fields (bson names) kept in memory: it is applied
+// to the initial load and to Change Stream events, and cached entities are partial (see mongo.PartialEntity).
 type Entity[T d] struct {
-	Collection      string
-	WarmupFilter    *bson.M
-	BeforeListeners []StreamEventListener[T]
-	AfterListeners  []StreamEventListener[T]
-	Notify          Notify[T]
-	Option          func(InMemory[T])
+	Collection        string
+	WarmupFilter      *bson.M
+	Filter            *Filter[T]
+	StreamFilter      *mongo.StreamFilter
+	Fields            []string
+	OnCollectionEvent func(ctx context.Context, event mongo.CollectionEvent)
+	FullDocument      bool
+	PreImages         bool
+	SoftDelete        bool
+	Hooks             mongo.Hooks[T]
+	Refs              *Refs
+	Audit             *Audit[T]
+	BeforeListeners   []StreamEventListener[T]
+	AfterListeners    []StreamEventListener[T]
+	Async             *AsyncOptions
+	Notify            Notify[T]
+	Option            func(InMemory[T])
 }
 
 // CacheWithEventListener combines an in-memory cache with event listeners and indexes.
 // It provides access to the cache, event listener, notification system, and all index types
 // (inverse, inverse unique, sorted, and suffix indexes).
+// Fields lists the cached fields when entities are partial (nil means full documents).
 type CacheWithEventListener[T d] struct {
 	Cache                Cache[T]
 	EventListener        EventListener[T]
@@ -99,6 +160,12 @@ type CacheWithEventListener[T d] struct {
 	SortedIndexes        map[string]SortedIndex[T]
 	SuffixIndexes        map[string]SuffixIndex[T]
 	AwaitNotify          Notify[T]
+	Fields               []string
+}
+
+// IsPartial reports whether cached entities hold only a subset of the document fields.
+func (c *CacheWithEventListener[T]) IsPartial() bool {
+	return c.Fields != nil
 }
 
 // NewCacheWithEventListener creates a new CacheWithEventListener with the specified listeners and notification system.
@@ -0,0 +1,109 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+// batchNotifier is implemented by the await notifier of a projection (see Notifier.AddListenerBatch).
+type batchNotifier interface {
+	AddListenerBatch(c func(operationType, id string)) string
+	DeleteListenerBatch(ui string)
+}
+
+// AwaitCreateMany creates the entities with a single bulk write (see mongo.Processor.CreateMany)
+// and waits until all the created entities are reflected in the in-memory cache.
+// errs has an element per entity: nil if it was created, otherwise its error.
+// If ctx is done before all the events are applied, the context error is returned.
+func (p *inMemory[T]) AwaitCreateMany(ctx context.Context, ps []T) (errs []error, err error) {
+	ids := make([]string, len(ps))
+	for i, it := range ps {
+		ids[i] = it.ID()
+	}
+	return p.awaitMany(ctx, mongo.InsertOperationType, ids, func() ([]error, error) {
+		return p.Mongo.Processor.CreateMany(ctx, ps)
+	})
+}
+
+// AwaitUpdateMany updates the entities with a single bulk write (see mongo.Processor.UpdateMany)
+// and waits until all the changes are reflected in the in-memory cache.
+// errs has an element per entity: nil if it was updated or has no changes, otherwise its error.
+// If ctx is done before all the events are applied, the context error is returned.
+func (p *inMemory[T]) AwaitUpdateMany(ctx context.Context, ps []T) (errs []error, err error) {
+	ids := make([]string, len(ps))
+	for i, it := range ps {
+		ids[i] = it.ID()
+	}
+	errs, err = p.awaitMany(ctx, mongo.UpdateOperationType, ids, func() ([]error, error) {
+		return p.Mongo.Processor.UpdateMany(ctx, ps)
+	})
+	for i, e := range errs {
+		if errors.Is(e, mongo.ErrNothingToUpdate) {
+			errs[i] = nil
+		}
+	}
+	return
+}
+
+// AwaitDeleteMany deletes the entities with a single bulk write (see mongo.Processor.DeleteMany)
+// and waits until all of them are removed from the in-memory cache.
+// In the soft-delete mode (see Entity.SoftDelete) the entities are marked deleted with a single write instead.
+// errs has an element per entity: nil if it was deleted, otherwise its error.
+// If ctx is done before all the events are applied, the context error is returned.
+func (p *inMemory[T]) AwaitDeleteMany(ctx context.Context, ps []T) (errs []error, err error) {
+	ids := make([]string, len(ps))
+	for i, it := range ps {
+		ids[i] = it.ID()
+	}
+	if p.soft != nil {
+		return p.awaitMany(ctx, mongo.DeleteOperationType, ids, func() ([]error, error) {
+			return p.softDeleteMany(ctx, ids)
+		})
+	}
+	return p.awaitMany(ctx, mongo.DeleteOperationType, ids, func() ([]error, error) {
+		return p.Mongo.Processor.DeleteMany(ctx, ids)
+	})
+}
+
+// awaitMany registers a single waiter for the events of the batch, runs the write
+// and waits for the events of the items which were written successfully.
+func (p *inMemory[T]) awaitMany(
+	ctx context.Context,
+	operationType string,
+	ids []string,
+	write func() (errs []error, err error),
+) (errs []error, err error) {
+	if p.CacheWithEventListener == nil {
+		return nil, errors.New("cache is not initialized, Await*Many requires cache")
+	}
+	notifier, ok := p.CacheWithEventListener.AwaitNotify.(batchNotifier)
+	if !ok {
+		return nil, errors.New("await notifier does not support batches")
+	}
+	w := newEventWaiter()
+	for _, id := range ids {
+		w.expect(operationType, id)
+	}
+	ui := notifier.AddListenerBatch(w.resolve)
+	defer notifier.DeleteListenerBatch(ui)
+	untrack := p.track(ctx, ids...)
+	errs, err = write()
+	if err != nil {
+		untrack()
+		return
+	}
+	for i, e := range errs {
+		if e != nil {
+			w.forget(operationType, ids[i])
+		}
+	}
+	w.ready()
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+// bulkProcessor applies created entities to the projection asynchronously, as the Change Stream does,
+// and fails the entities listed in errs.
+type bulkProcessor struct {
+	*mongo.Processor[*Image]
+	c    *CacheWithEventListener[*Image]
+	errs map[int]error
+}
+
+func (p *bulkProcessor) CreateMany(ctx context.Context, ps []*Image) (errs []error, err error) {
+	errs = make([]error, len(ps))
+	for i, it := range ps {
+		if errs[i] = p.errs[i]; errs[i] != nil {
+			continue
+		}
+		go p.c.EventListener.Add(context.Background(), it)
+	}
+	return
+}
+
+func TestInMemory_AwaitCreateMany(t *testing.T) {
+	c := NewCacheWithEventListener[*Image](nil, nil, nil)
+	failed := errors.New("duplicate key")
+	im := &inMemory[*Image]{
+		CacheWithEventListener: c,
+		Mongo:                  &mongo.Mongo[*Image]{Processor: &bulkProcessor{c: c, errs: map[int]error{1: failed}}},
+	}
+	ps := []*Image{{}, {}, {}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	errs, err := im.AwaitCreateMany(ctx, ps)
+	assert.NoError(t, err)
+	assert.Equal(t, []error{nil, failed, nil}, errs)
+	for _, i := range []int{0, 2} {
+		_, found := c.Cache.Get(ctx, ps[i].ID())
+		assert.True(t, found)
+	}
+}
+
+func (p *bulkProcessor) Upsert(ctx context.Context, ps *Image) (created bool, err error) {
+	_, cached := p.c.Cache.GetIndexByID(ps.ID())
+	if cached {
+		go p.c.EventListener.Update(context.Background(), ps.Id, ps, nil)
+	} else {
+		go p.c.EventListener.Add(context.Background(), ps)
+	}
+	return !cached, nil
+}
+
+func TestInMemory_AwaitUpsert(t *testing.T) {
+	c := NewCacheWithEventListener[*Image](nil, nil, nil)
+	im := &inMemory[*Image]{
+		CacheWithEventListener: c,
+		Mongo:                  &mongo.Mongo[*Image]{Processor: &bulkProcessor{c: c}},
+	}
+	ctx := context.Background()
+	name := "name"
+	img := &Image{Name: &name}
+	created, err := im.AwaitUpsert(ctx, img)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	_, found := c.Cache.Get(ctx, img.ID())
+	assert.True(t, found)
+
+	changed := "changed"
+	created, err = im.AwaitUpsert(ctx, &Image{D: D{Id: img.Id}, Name: &changed})
+	assert.NoError(t, err)
+	assert.False(t, created)
+	it, _ := c.Cache.Get(ctx, img.ID())
+	assert.Equal(t, changed, *it.Name)
+
+	// soft-deleted: not brought back
+	yes := true
+	im.soft = newSoftDeleteHandler[*Image](c.EventListener, c.Cache, c.AwaitNotify)
+	im.soft.keep(ctx, &Image{D: D{Id: img.Id, Deleted: &yes}})
+	_, err = im.AwaitUpsert(ctx, &Image{D: D{Id: img.Id}, Name: &name})
+	assert.ErrorIs(t, err, mongo.ErrPreconditionFailed)
+}
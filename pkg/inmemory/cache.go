@@ -20,6 +20,7 @@ type Cache[T d] interface {
 	GetIDByIndex(idx int) (id string, found bool)
 	Add(ctx context.Context, v T)
 	Update(ctx context.Context, _id primitive.ObjectID, updatedFields T, removedFields []string)
+	UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string)
 	Delete(ctx context.Context, _id primitive.ObjectID)
 }
 
@@ -88,14 +89,32 @@ func (c *cache[T]) Add(ctx context.Context, v T) {
 
 // Update updates an existing entity in the cache with the provided changes.
 // UpdatedFields contains the new field values, and removedFields lists fields that should be cleared.
+// The changed fields are inferred from the values: nil pointers, nil slices and nil maps are left untouched.
+// Use UpdateFields when the fields present in the change are known.
 func (c *cache[T]) Update(ctx context.Context, _id primitive.ObjectID, updatedFields T, removedFields []string) {
+	c.UpdateFields(ctx, _id, updatedFields, nil, removedFields)
+}
+
+// UpdateFields updates an existing entity in the cache with the provided changes.
+// Fields lists the bson names of the top-level fields present in the change (the keys of updatedFields of the event):
+// only these fields are changed, whatever their value, so zero values, nil and empty slices or maps are applied too,
+// and fields absent from the change keep their value. A nil fields set behaves as Update.
+func (c *cache[T]) UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string) {
 	c.Lock()
 	defer c.Unlock()
 	if it, ok := c.data[_id.Hex()]; ok {
 		ufv := reflect.ValueOf(updatedFields).Elem()
 		uft := ufv.Type()
 		itv := reflect.ValueOf(it).Elem()
-		c._upd(itv, ufv)
+		if fields != nil {
+			present := make(map[string]struct{}, len(fields))
+			for _, f := range fields {
+				present[f] = struct{}{}
+			}
+			c._updPresent(itv, ufv, present)
+		} else {
+			c._upd(itv, ufv)
+		}
 		for _, fieldName := range removedFields {
 			for i := 0; i < ufv.NumField(); i++ {
 				fieldValue := ufv.Field(i)
@@ -107,7 +126,6 @@ func (c *cache[T]) Update(ctx context.Context, _id primitive.ObjectID, updatedFi
 		}
 	}
 }
-
 func (c *cache[T]) _upd(itv reflect.Value, v reflect.Value) {
 	t := v.Type()
 	for i := 0; i < v.NumField(); i++ {
@@ -137,6 +155,25 @@ func (c *cache[T]) _upd(itv reflect.Value, v reflect.Value) {
 	}
 }
 
+// _updPresent copies the fields of v present in the change to itv. Untagged struct fields are inlined.
+func (c *cache[T]) _updPresent(itv reflect.Value, v reflect.Value, present map[string]struct{}) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		fieldType := t.Field(i)
+		if !fieldType.IsExported() {
+			continue
+		}
+		key := bsonKey(fieldType)
+		if key == "" && v.Field(i).Kind() == reflect.Struct {
+			c._updPresent(itv.FieldByName(fieldType.Name), v.Field(i), present)
+			continue
+		}
+		if _, ok := present[key]; ok {
+			itv.FieldByName(fieldType.Name).Set(v.Field(i))
+		}
+	}
+}
+
 // Delete ...
 func (c *cache[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
 	c.Lock()
@@ -145,6 +182,15 @@ func (c *cache[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
 	c.deleteByID(_id.Hex())
 }
 
+// copyOf returns a deep copy of the entity, as Get returns it, so it can be read while the cached one changes.
+func copyOf[T d](ctx context.Context, v T) T {
+	ps, err := (&cache[T]{}).prepareCreate(ctx, reflect.ValueOf(v))
+	if err != nil {
+		return v
+	}
+	return ps.Interface().(T)
+}
+
 func (p *cache[T]) prepareCreate(ctx context.Context, ps reflect.Value) (prepared reflect.Value, err error) {
 	switch ps.Kind() {
 	case reflect.Ptr:
@@ -164,3 +164,27 @@ func TestCache_Get(t *testing.T) {
 	assert.Nil(t, v.Slice)
 	assert.Nil(t, v.Map)
 }
+
+func TestCache_UpdateFields(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*V](map[string]*V{})
+	id := primitive.NewObjectIDFromTimestamp(time.Now())
+	c.Add(ctx, &V{Id: id, Name: &name1, Number: &number1, Slice: slice1, Map: map1, S: S{CS: C{Name: name2}}})
+
+	// only the present fields change: the empty slice and the zero number are applied, s is kept
+	zero := 0
+	c.UpdateFields(ctx, id, &V{Number: &zero, Slice: []string{}}, []string{"number", "slice"}, nil)
+	v, _ := c.Get(ctx, id.Hex())
+	assert.Equal(t, name1, *v.Name)
+	assert.Equal(t, 0, *v.Number)
+	assert.Empty(t, v.Slice)
+	assert.Equal(t, map1, v.Map)
+	assert.Equal(t, name2, v.S.CS.Name)
+
+	// a present null clears the field
+	c.UpdateFields(ctx, id, &V{}, []string{"name", "s"}, nil)
+	v, _ = c.Get(ctx, id.Hex())
+	assert.Nil(t, v.Name)
+	assert.Empty(t, v.S.CS.Name)
+	assert.Equal(t, map1, v.Map)
+}
@@ -0,0 +1,74 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Condition is the precondition of a conditional write (see AwaitUpdateIf).
+// Filter is evaluated by MongoDB together with the write. Match is evaluated on the cached entity,
+// and the write is then made only if the document still has the version of the cached entity.
+// Either or both of them may be set.
+type Condition[T d] struct {
+	Filter bson.D
+	Match  func(v T) bool
+}
+
+// Where returns a condition evaluated by MongoDB, e.g. Where[*Order](bson.D{{Key: "status", Value: "pending"}}).
+func Where[T d](filter bson.D) Condition[T] {
+	return Condition[T]{Filter: filter}
+}
+
+// If returns a condition evaluated on the cached entity, e.g. If(func(o *Order) bool { return o.Status == "pending" }).
+func If[T d](match func(v T) bool) Condition[T] {
+	return Condition[T]{Match: match}
+}
+
+// AwaitUpdateIf updates an entity as AwaitUpdate does, if it matches the condition, as a single
+// compare-and-set write, and waits until the change is reflected in the in-memory cache.
+// mongo.ErrPreconditionFailed is returned if the entity does not match the condition,
+// so state transitions are safe without a transaction. mongo.ErrNothingToUpdate is returned
+// if the entity has no changes, in which case the filter of the condition is not checked.
+func (p *inMemory[T]) AwaitUpdateIf(ctx context.Context, ps T, cond Condition[T]) (res T, err error) {
+	if p.CacheWithEventListener == nil {
+		return res, errors.New("cache is not initialized, AwaitUpdateIf requires cache")
+	}
+	filter := cond.Filter
+	if cond.Match != nil {
+		cached, found := p.CacheWithEventListener.Cache.Get(ctx, ps.ID())
+		if !found {
+			return res, mongo.ErrNotFound
+		}
+		if !cond.Match(cached) {
+			return res, mongo.ErrPreconditionFailed
+		}
+		if cached.Version() != nil {
+			filter = bson.D{{Key: "$and", Value: bson.A{
+				bson.D{{Key: "version", Value: *cached.Version()}},
+				append(bson.D{}, filter...),
+			}}}
+		}
+	}
+	ch := make(chan struct{}, 1)
+	ui := p.CacheWithEventListener.AwaitNotify.AddListenerUpdate(ps.ID(), func() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	})
+	res, err = p.Mongo.Processor.UpdateIf(ctx, ps, filter)
+	if err != nil {
+		p.CacheWithEventListener.AwaitNotify.DeleteListenerUpdate(ps.ID(), ui)
+		return
+	}
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		p.CacheWithEventListener.AwaitNotify.DeleteListenerUpdate(ps.ID(), ui)
+		err = ctx.Err()
+	}
+	return
+}
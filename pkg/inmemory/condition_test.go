@@ -0,0 +1,56 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+// condProcessor records the condition of UpdateIf and applies the update asynchronously, as the Change Stream does.
+type condProcessor struct {
+	*mongo.Processor[*Image]
+	c    *CacheWithEventListener[*Image]
+	cond bson.D
+}
+
+func (p *condProcessor) UpdateIf(ctx context.Context, ps *Image, cond bson.D) (*Image, error) {
+	p.cond = cond
+	go p.c.EventListener.Update(context.Background(), ps.Id, ps, nil)
+	return ps, nil
+}
+
+func TestInMemory_AwaitUpdateIf(t *testing.T) {
+	ctx := context.Background()
+	c := NewCacheWithEventListener[*Image](nil, nil, nil)
+	p := &condProcessor{c: c}
+	im := &inMemory[*Image]{
+		CacheWithEventListener: c,
+		Mongo:                  &mongo.Mongo[*Image]{Processor: p},
+	}
+	pending, done, png := "pending", "done", "png"
+	version := int64(1)
+	img := &Image{D: D{V: &version}, Name: &pending}
+	c.EventListener.Add(ctx, img)
+	isPending := func(v *Image) bool { return v.Name != nil && *v.Name == pending }
+
+	// the filter is passed to MongoDB as is
+	filter := bson.D{{Key: "name", Value: pending}}
+	_, err := im.AwaitUpdateIf(ctx, &Image{D: D{Id: img.Id}, Mime: &png}, Where[*Image](filter))
+	assert.NoError(t, err)
+	assert.Equal(t, filter, p.cond)
+
+	// the predicate is checked on the cached entity and the write is conditioned on its version
+	_, err = im.AwaitUpdateIf(ctx, &Image{D: D{Id: img.Id}, Name: &done}, If(isPending))
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{bson.D{{Key: "version", Value: version}}, bson.D{}}}}, p.cond)
+	it, _ := c.Cache.Get(ctx, img.ID())
+	assert.Equal(t, done, *it.Name)
+
+	// no longer pending
+	_, err = im.AwaitUpdateIf(ctx, &Image{D: D{Id: img.Id}, Name: &pending}, If(isPending))
+	assert.ErrorIs(t, err, mongo.ErrPreconditionFailed)
+}
@@ -0,0 +1,165 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Derived is a read model computed from one or more source projections,
+// for example an OrderSummary built from Order and Customer.
+// It owns its own cache, indexes and listeners (built from the struct tags of P, as for any projection)
+// and is kept up to date by listening to the sources' EventListener via DeriveFrom.
+//
+// Derived entities are never written to MongoDB: they are recomputed from the source caches
+// whenever a source entity they depend on changes. Derived IDs must be valid ObjectID hex strings.
+type Derived[P d] struct {
+	*CacheWithEventListener[P]
+	mu      sync.Mutex
+	compute func(ctx context.Context, id string) (p P, found bool)
+}
+
+// NewDerived creates a new Derived projection.
+// compute builds the derived entity with the given ID from the source caches;
+// it returns found=false when the entity should not exist (it is then removed from the projection).
+func NewDerived[P d](
+	compute func(ctx context.Context, id string) (p P, found bool),
+	beforeListeners []StreamEventListener[P],
+	afterListeners []StreamEventListener[P],
+	notify Notify[P],
+) *Derived[P] {
+	return &Derived[P]{
+		CacheWithEventListener: NewCacheWithEventListener[P](beforeListeners, afterListeners, notify),
+		compute:                compute,
+	}
+}
+
+// Refresh recomputes the derived entities with the given IDs and applies the result
+// to the cache, indexes and listeners of the projection as an Add, Update or Delete event.
+func (dv *Derived[P]) Refresh(ctx context.Context, ids ...string) {
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+	for _, id := range ids {
+		dv.refresh(ctx, id)
+	}
+}
+
+func (dv *Derived[P]) refresh(ctx context.Context, id string) {
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+	p, found := dv.compute(ctx, id)
+	_, cached := dv.Cache.GetIndexByID(id)
+	switch {
+	case found && cached:
+		dv.EventListener.Update(ctx, _id, p, nilFields(p))
+	case found:
+		dv.EventListener.Add(ctx, p)
+	case cached:
+		dv.EventListener.Delete(ctx, _id)
+	}
+}
+
+// DeriveFrom subscribes a derived projection to a source projection.
+// resolve maps a source entity to the IDs of the derived entities that depend on it.
+// It is evaluated both on the state before the change (taken from the source cache)
+// and on the state after it, so derived entities that stop depending on a source entity are refreshed too.
+func DeriveFrom[S d, P d](
+	dv *Derived[P],
+	source EventListener[S],
+	cache Cache[S],
+	resolve func(ctx context.Context, s S) (ids []string),
+) {
+	ds := &derivedSource[S, P]{
+		derived: dv,
+		cache:   cache,
+		resolve: resolve,
+		pending: map[string][]string{},
+	}
+	source.AddListener(&derivedSourceBefore[S, P]{ds}, true)
+	source.AddListener(ds, false)
+}
+
+// derivedSource is the after-phase listener of a source projection.
+// It refreshes the derived entities resolved from both the old and the new state of a source entity.
+type derivedSource[S d, P d] struct {
+	sync.Mutex
+	derived *Derived[P]
+	cache   Cache[S]
+	resolve func(ctx context.Context, s S) (ids []string)
+	pending map[string][]string
+}
+
+func (s *derivedSource[S, P]) remember(ctx context.Context, id string) {
+	it, found := s.cache.Get(ctx, id)
+	if !found {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.pending[id] = s.resolve(ctx, it)
+}
+
+func (s *derivedSource[S, P]) take(id string) (ids []string) {
+	s.Lock()
+	defer s.Unlock()
+	ids = s.pending[id]
+	delete(s.pending, id)
+	return
+}
+
+// Add ...
+func (s *derivedSource[S, P]) Add(ctx context.Context, v S) {
+	s.derived.Refresh(ctx, unique(s.take(v.ID()), s.resolve(ctx, v))...)
+}
+
+// Update ...
+func (s *derivedSource[S, P]) Update(ctx context.Context, _id primitive.ObjectID, updatedFields S, removedFields []string) {
+	ids := s.take(_id.Hex())
+	if it, found := s.cache.Get(ctx, _id.Hex()); found {
+		ids = unique(ids, s.resolve(ctx, it))
+	}
+	s.derived.Refresh(ctx, ids...)
+}
+
+// Delete ...
+func (s *derivedSource[S, P]) Delete(ctx context.Context, _id primitive.ObjectID) {
+	s.derived.Refresh(ctx, s.take(_id.Hex())...)
+}
+
+// derivedSourceBefore captures the derived IDs resolved from the old state of a source entity
+// before the source cache is changed.
+type derivedSourceBefore[S d, P d] struct {
+	*derivedSource[S, P]
+}
+
+// Add ...
+func (s *derivedSourceBefore[S, P]) Add(ctx context.Context, v S) {
+	s.remember(ctx, v.ID())
+}
+
+// Update ...
+func (s *derivedSourceBefore[S, P]) Update(ctx context.Context, _id primitive.ObjectID, updatedFields S, removedFields []string) {
+	s.remember(ctx, _id.Hex())
+}
+
+// Delete ...
+func (s *derivedSourceBefore[S, P]) Delete(ctx context.Context, _id primitive.ObjectID) {
+	s.remember(ctx, _id.Hex())
+}
+
+func unique(in ...[]string) (res []string) {
+	t := map[string]struct{}{}
+	for _, i := range in {
+		for _, v := range i {
+			if _, ok := t[v]; ok {
+				continue
+			}
+			t[v] = struct{}{}
+			res = append(res, v)
+		}
+	}
+	return
+}
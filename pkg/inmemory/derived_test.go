@@ -0,0 +1,85 @@
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+)
+
+type Customer struct {
+	D
+	Name *string `bson:"name"`
+}
+
+type Order struct {
+	D
+	CustomerID *string `bson:"customerId"`
+	Total      *int    `bson:"total"`
+}
+
+type OrderSummary struct {
+	D
+	CustomerName *string `bson:"customerName" indexes:"inverse:customerName:from"`
+	Total        *int    `bson:"total"`
+}
+
+func TestDerived(t *testing.T) {
+	ctx := context.Background()
+	customers := inmemory.NewCacheWithEventListener[*Customer](nil, nil, nil)
+	orders := inmemory.NewCacheWithEventListener[*Order](nil, nil, nil)
+	summaries := inmemory.NewDerived[*OrderSummary](func(ctx context.Context, id string) (*OrderSummary, bool) {
+		o, found := orders.Cache.Get(ctx, id)
+		if !found {
+			return nil, false
+		}
+		s := &OrderSummary{D: D{Id: o.Id}, Total: o.Total}
+		if o.CustomerID != nil {
+			if c, found := customers.Cache.Get(ctx, *o.CustomerID); found {
+				s.CustomerName = c.Name
+			}
+		}
+		return s, true
+	}, nil, nil, nil)
+	inmemory.DeriveFrom(summaries, orders.EventListener, orders.Cache, func(ctx context.Context, o *Order) []string {
+		return []string{o.ID()}
+	})
+	inmemory.DeriveFrom(summaries, customers.EventListener, customers.Cache, func(ctx context.Context, c *Customer) (ids []string) {
+		for _, id := range orders.Cache.All(ctx) {
+			if o, found := orders.Cache.Get(ctx, id); found && o.CustomerID != nil && *o.CustomerID == c.ID() {
+				ids = append(ids, id)
+			}
+		}
+		return
+	})
+
+	customer := &Customer{Name: &name1}
+	customers.EventListener.Add(ctx, customer)
+	customerID := customer.ID()
+	order := &Order{CustomerID: &customerID, Total: &number1}
+	orders.EventListener.Add(ctx, order)
+
+	s, found := summaries.Cache.Get(ctx, order.ID())
+	assert.True(t, found)
+	assert.Equal(t, name1, *s.CustomerName)
+	assert.Equal(t, number1, *s.Total)
+	assert.Equal(t, []string{order.ID()}, summaries.InverseIndexes["customerName"].Get(ctx, &name1))
+
+	customers.EventListener.Update(ctx, customer.Id, &Customer{Name: &name2}, nil)
+	s, found = summaries.Cache.Get(ctx, order.ID())
+	assert.True(t, found)
+	assert.Equal(t, name2, *s.CustomerName)
+	assert.Empty(t, summaries.InverseIndexes["customerName"].Get(ctx, &name1))
+	assert.Equal(t, []string{order.ID()}, summaries.InverseIndexes["customerName"].Get(ctx, &name2))
+
+	orders.EventListener.Delete(ctx, order.Id)
+	_, found = summaries.Cache.Get(ctx, order.ID())
+	assert.False(t, found)
+	assert.Empty(t, summaries.Cache.All(ctx))
+
+	_, found = summaries.Cache.Get(ctx, primitive.NewObjectID().Hex())
+	assert.False(t, found)
+}
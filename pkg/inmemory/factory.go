@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"sync"
 
 	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
 	"github.com/rs/zerolog"
@@ -41,10 +42,19 @@ type stream interface {
 	AddListener(ctx context.Context, db, col string, listener streamListener)
 }
 
+// removableStream is implemented by streams whose listeners can be removed (see mongo.Stream.RemoveListener).
+type removableStream interface {
+	RemoveListener(ctx context.Context, db, col string, listener streamListener) bool
+}
+
 type streamListener = interface {
 	Listen(ctx context.Context, change []byte) (err error)
 }
 
+type filteredStream interface {
+	AddListenerWithFilter(ctx context.Context, db, col string, listener streamListener, filter mongo.StreamFilter)
+}
+
 // InMemory provides the main interface for working with typed entities in MongoDB
 // with an in-memory projection layer. It combines MongoDB operations with Change Streams
 // synchronization to maintain a strongly consistent in-memory cache.
@@ -54,13 +64,41 @@ type InMemory[T d] interface {
 	Spawn(ctx context.Context) T
 	AwaitCreate(ctx context.Context, ps T) (id string, err error)
 	AwaitUpdate(ctx context.Context, ps T) (res T, err error)
+	AwaitUpdateIf(ctx context.Context, ps T, cond Condition[T]) (res T, err error)
 	AwaitUpdateDoc(ctx context.Context, id string, set, unset bson.D) (found bool, err error)
+	AwaitUpdateOps(ctx context.Context, id string, u *mongo.Update) (found bool, err error)
 	AwaitDelete(ctx context.Context, ps T) (err error)
+	GetIncludeDeleted(ctx context.Context, id string) (it T, found bool)
+	AllIncludeDeleted(ctx context.Context) (ids []string)
+	Restore(ctx context.Context, id string) (err error)
+	Purge(ctx context.Context, id string) (err error)
+	AwaitUpsert(ctx context.Context, ps T) (created bool, err error)
+	AwaitDeleteWhere(ctx context.Context, filter bson.M) (ids []string, err error)
+	AwaitCreateMany(ctx context.Context, ps []T) (errs []error, err error)
+	AwaitUpdateMany(ctx context.Context, ps []T) (errs []error, err error)
+	AwaitDeleteMany(ctx context.Context, ps []T) (errs []error, err error)
+	Resync(ctx context.Context) (err error)
+	CreateOp(ps T) TxOp
+	UpdateOp(ps T) TxOp
+	DeleteOp(ps T) TxOp
+	Close(ctx context.Context)
+}
+
+// syncHandler is the head of the handler chain of a projection (the EventListener, possibly wrapped by a filter).
+type syncHandler[T d] interface {
+	StreamEventListener[T]
+	Replace(ctx context.Context, v T)
 }
 
 type inMemory[T d] struct {
 	CacheWithEventListener *CacheWithEventListener[T]
 	Mongo                  *mongo.Mongo[T]
+	handler                syncHandler[T]
+	soft                   *softDeleteHandler[T]
+	audit                  *Audit[T]
+	load                   func(ctx context.Context) (items []T, err error)
+	closers                []func(ctx context.Context)
+	closeOnce              sync.Once
 }
 
 // Spawn creates a new instance of the entity type T.
@@ -100,9 +138,11 @@ func (p *inMemory[T]) AwaitCreate(ctx context.Context, ps T) (id string, err err
 	ui := p.CacheWithEventListener.AwaitNotify.AddListenerCreate(ps.ID(), func() {
 		ch <- struct{}{}
 	})
+	untrack := p.track(ctx, ps.ID())
 	_, err = p.Mongo.Processor.Create(ctx, ps)
 	if err != nil {
 		p.CacheWithEventListener.AwaitNotify.DeleteListenerCreate(ps.ID(), ui)
+		untrack()
 		return
 	}
 	<-ch
@@ -122,9 +162,11 @@ func (p *inMemory[T]) AwaitUpdate(ctx context.Context, ps T) (res T, err error)
 	ui := p.CacheWithEventListener.AwaitNotify.AddListenerUpdate(ps.ID(), func() {
 		ch <- struct{}{}
 	})
+	untrack := p.track(ctx, ps.ID())
 	res, err = p.Mongo.Processor.Update(ctx, ps)
 	if err != nil {
 		p.CacheWithEventListener.AwaitNotify.DeleteListenerUpdate(ps.ID(), ui)
+		untrack()
 		if errors.Is(err, mongo.ErrNothingToUpdate) {
 			err = nil
 		}
@@ -146,9 +188,11 @@ func (p *inMemory[T]) AwaitUpdateDoc(ctx context.Context, id string, set, unset
 	ui := p.CacheWithEventListener.AwaitNotify.AddListenerUpdate(id, func() {
 		ch <- struct{}{}
 	})
+	untrack := p.track(ctx, id)
 	found, err = p.Mongo.Updater.UpdateOne(ctx, id, nil, set, unset)
 	if err != nil {
 		p.CacheWithEventListener.AwaitNotify.DeleteListenerUpdate(id, ui)
+		untrack()
 		if errors.Is(err, mongo.ErrNothingToUpdate) {
 			err = nil
 		}
@@ -158,27 +202,284 @@ func (p *inMemory[T]) AwaitUpdateDoc(ctx context.Context, id string, set, unset
 	return
 }
 
+// AwaitUpdateOps applies the field operators of the update to a document (see mongo.Update) and waits until
+// the change is reflected in the in-memory cache: the cached entity holds the values computed by the server.
+// Returns a boolean indicating if the document was found and updated.
+func (p *inMemory[T]) AwaitUpdateOps(ctx context.Context, id string, u *mongo.Update) (found bool, err error) {
+	if p.CacheWithEventListener == nil {
+		return false, errors.New("cache is not initialized, AwaitUpdateOps requires cache")
+	}
+	return p.await(ctx, id, p.CacheWithEventListener.AwaitNotify.AddListenerUpdate, p.CacheWithEventListener.AwaitNotify.DeleteListenerUpdate, func() (bool, error) {
+		return p.Mongo.Updater.UpdateOps(ctx, id, nil, u)
+	})
+}
+
+// await registers a listener for the event of the entity, runs the write and waits for the event.
+// If the write fails or matches no document, the listener is removed without waiting and found is false.
+func (p *inMemory[T]) await(
+	ctx context.Context,
+	id string,
+	add func(id string, c func()) string,
+	del func(id string, ui string),
+	write func() (found bool, err error),
+) (found bool, err error) {
+	ch := make(chan struct{}, 1)
+	ui := add(id, func() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	})
+	untrack := p.track(ctx, id)
+	found, err = write()
+	if err != nil || !found {
+		del(id, ui)
+		untrack()
+		return
+	}
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		del(id, ui)
+		err = ctx.Err()
+	}
+	return
+}
+
 // AwaitDelete deletes an entity from MongoDB and waits until the change is reflected in the in-memory cache.
 // This provides read-after-write consistency: after AwaitDelete returns, subsequent reads from the cache
 // will not find the deleted entity.
+// In the soft-delete mode (see Entity.SoftDelete) the entity is marked deleted instead of being removed.
 func (p *inMemory[T]) AwaitDelete(ctx context.Context, ps T) (err error) {
 	if p.CacheWithEventListener == nil {
 		return errors.New("cache is not initialized, AwaitDelete requires cache")
 	}
+	if p.soft != nil {
+		return p.softDelete(ctx, ps.ID())
+	}
 	ch := make(chan struct{})
 	defer close(ch)
 	ui := p.CacheWithEventListener.AwaitNotify.AddListenerDelete(ps.ID(), func() {
 		ch <- struct{}{}
 	})
+	untrack := p.track(ctx, ps.ID())
 	err = p.Mongo.Processor.Delete(ctx, ps.ID())
 	if err != nil {
 		p.CacheWithEventListener.AwaitNotify.DeleteListenerDelete(ps.ID(), ui)
+		untrack()
 		return
 	}
 	<-ch
 	return
 }
 
+// AwaitUpsert creates or updates an entity in MongoDB (see mongo.Processor.Upsert) and waits until
+// the change is reflected in the in-memory cache. created reports whether the entity was inserted.
+// A soft-deleted entity is not brought back (see Restore): mongo.ErrPreconditionFailed is returned for it.
+func (p *inMemory[T]) AwaitUpsert(ctx context.Context, ps T) (created bool, err error) {
+	if p.CacheWithEventListener == nil {
+		return false, errors.New("cache is not initialized, AwaitUpsert requires cache")
+	}
+	if p.soft != nil && p.soft.isSoftDeleted(ps.ID()) {
+		return false, mongo.ErrPreconditionFailed
+	}
+	// The kind of the event is known only after the write: wait for either of them.
+	ch := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	id := ps.ID()
+	uc := p.CacheWithEventListener.AwaitNotify.AddListenerCreate(id, notify)
+	uu := p.CacheWithEventListener.AwaitNotify.AddListenerUpdate(id, notify)
+	untrack := p.track(ctx, id)
+	created, err = p.Mongo.Processor.Upsert(ctx, ps)
+	if err != nil {
+		untrack()
+	}
+	if err != nil || created {
+		p.CacheWithEventListener.AwaitNotify.DeleteListenerUpdate(id, uu)
+	}
+	if err != nil || !created {
+		p.CacheWithEventListener.AwaitNotify.DeleteListenerCreate(id, uc)
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNothingToUpdate) {
+			err = nil
+		}
+		return
+	}
+	<-ch
+	return
+}
+
+// AwaitDeleteWhere deletes the documents matching the filter and waits until all of them are removed
+// from the in-memory cache. The IDs of the matching documents are resolved first and the delete is
+// restricted to them, so documents which start matching concurrently are not deleted.
+// In the soft-delete mode (see Entity.SoftDelete) the documents which are not deleted yet are marked deleted instead.
+// Returns the IDs of the resolved documents. All of them are checked first (see mongo.Processor.PrepareDelete):
+// if the BeforeDelete hook or a restrict reference rejects any of them, nothing is deleted. The on-delete
+// policies of the references are applied to the deleted documents once the delete succeeds.
+func (p *inMemory[T]) AwaitDeleteWhere(ctx context.Context, filter bson.M) (ids []string, err error) {
+	if p.CacheWithEventListener == nil {
+		return nil, errors.New("cache is not initialized, AwaitDeleteWhere requires cache")
+	}
+	notifier, ok := p.CacheWithEventListener.AwaitNotify.(batchNotifier)
+	if !ok {
+		return nil, errors.New("await notifier does not support batches")
+	}
+	w := newEventWaiter()
+	ui := notifier.AddListenerBatch(w.resolve)
+	defer notifier.DeleteListenerBatch(ui)
+	if p.soft != nil {
+		filter = notDeleted(filter)
+	}
+	its, err := p.Mongo.Searcher.FindWithFilter(ctx, filter)
+	if err != nil || len(its) == 0 {
+		return
+	}
+	_ids := make(bson.A, 0, len(its))
+	for _, it := range its {
+		if err = p.Mongo.Processor.PrepareDelete(ctx, it.ID()); err != nil {
+			return nil, err
+		}
+	}
+	for _, it := range its {
+		_id, e := primitive.ObjectIDFromHex(it.ID())
+		if e != nil {
+			continue
+		}
+		ids = append(ids, it.ID())
+		_ids = append(_ids, _id)
+		w.expect(mongo.DeleteOperationType, it.ID())
+	}
+	untrack := make(map[string]func(), len(ids))
+	for _, id := range ids {
+		untrack[id] = p.track(ctx, id)
+	}
+	deleted, err := p.removeMany(ctx, bson.M{"$and": bson.A{
+		filter,
+		bson.M{"_id": bson.M{"$in": _ids}},
+	}})
+	if err != nil {
+		for _, u := range untrack {
+			u()
+		}
+		return
+	}
+	if deleted < len(ids) {
+		// Documents which stopped matching the filter after they were resolved are not deleted.
+		if ids, err = p.forgetRemaining(ctx, w, ids, _ids, untrack); err != nil {
+			return
+		}
+	}
+	for _, id := range ids {
+		if err = p.Mongo.Processor.CompleteDelete(ctx, id); err != nil {
+			return
+		}
+	}
+	// Documents which are no longer cached are deleted already, or were never in the projection.
+	for _, id := range ids {
+		if _, found := p.CacheWithEventListener.Cache.GetIndexByID(id); !found {
+			w.forget(mongo.DeleteOperationType, id)
+		}
+	}
+	w.ready()
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// removeMany removes the documents matching the filter, or marks them deleted in the soft-delete mode.
+func (p *inMemory[T]) removeMany(ctx context.Context, filter bson.M) (deleted int, err error) {
+	if p.soft != nil {
+		return p.Mongo.Updater.UpdateMany(ctx, filter, bson.D{{Key: "deleted", Value: true}})
+	}
+	return p.Mongo.Remover.RemoveMany(ctx, filter)
+}
+
+// forgetRemaining stops waiting for the delete events of the resolved documents which still exist
+// (are not soft-deleted in the soft-delete mode) and untracks them, and returns the IDs of the deleted ones.
+func (p *inMemory[T]) forgetRemaining(ctx context.Context, w *eventWaiter, ids []string, _ids bson.A, untrack map[string]func()) (deleted []string, err error) {
+	filter := bson.M{"_id": bson.M{"$in": _ids}}
+	if p.soft != nil {
+		filter = notDeleted(filter)
+	}
+	remaining, err := p.Mongo.Searcher.FindWithFilter(ctx, filter)
+	if err != nil {
+		return
+	}
+	exists := make(map[string]struct{}, len(remaining))
+	for _, it := range remaining {
+		exists[it.ID()] = struct{}{}
+		w.forget(mongo.DeleteOperationType, it.ID())
+		if u, ok := untrack[it.ID()]; ok {
+			u()
+		}
+	}
+	for _, id := range ids {
+		if _, ok := exists[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+	return
+}
+
+// Resync reloads the collection from MongoDB and reconciles the projection with it:
+// loaded documents are applied as full document swaps and cached documents which no longer exist are deleted.
+// It is intended for recovery (e.g. after a collection event) and is not serialized with Change Stream events.
+func (p *inMemory[T]) Resync(ctx context.Context) (err error) {
+	if p.CacheWithEventListener == nil {
+		return errors.New("cache is not initialized, Resync requires cache")
+	}
+	its, err := p.load(ctx)
+	if err != nil {
+		return
+	}
+	loaded := make(map[string]struct{}, len(its))
+	for _, it := range its {
+		loaded[it.ID()] = struct{}{}
+		p.handler.Replace(ctx, it)
+	}
+	for _, id := range p.CacheWithEventListener.Cache.All(ctx) {
+		if _, ok := loaded[id]; ok {
+			continue
+		}
+		_id, e := primitive.ObjectIDFromHex(id)
+		if e != nil {
+			continue
+		}
+		p.handler.Delete(ctx, _id)
+	}
+	if p.soft != nil {
+		for _, id := range p.soft.deleted.All(ctx) {
+			if _, ok := loaded[id]; ok {
+				continue
+			}
+			if _id, e := primitive.ObjectIDFromHex(id); e == nil {
+				p.handler.Delete(ctx, _id)
+			}
+		}
+	}
+	return
+}
+
+// Close detaches the projection from the Stream (if it supports mongo.Stream.RemoveListener) and stops
+// the asynchronous listeners of Entity.Async, waiting until their queued events are dispatched.
+// The projection is no longer updated by Change Stream events afterwards. Close is idempotent.
+func (p *inMemory[T]) Close(ctx context.Context) {
+	p.closeOnce.Do(func() {
+		for _, c := range p.closers {
+			c(ctx)
+		}
+	})
+}
+
 // NewInMemory creates a new InMemory instance for a typed entity.
 // It sets up MongoDB operations, Change Streams listener, and in-memory cache with indexes.
 // On initialization, it loads all existing documents from MongoDB into the cache.
@@ -194,14 +495,52 @@ func NewInMemory[T d](ctx context.Context, stream stream, deps MongoDeps, entity
 		Update(ctx context.Context, id primitive.ObjectID, updatedFields T, removedFields []string)
 		Delete(ctx context.Context, _id primitive.ObjectID)
 	}
+	var filtered *filteredHandler[T]
+	var soft *softDeleteHandler[T]
+	var head syncHandler[T]
+	var closers []func(ctx context.Context)
 	if isStreamValid(stream) {
+		afterListeners := entityDeps.AfterListeners
+		if entityDeps.Async != nil {
+			afterListeners = make([]StreamEventListener[T], len(entityDeps.AfterListeners))
+			for k, l := range entityDeps.AfterListeners {
+				a, err := NewAsyncListener[T](l, *entityDeps.Async)
+				if err != nil {
+					for _, c := range closers {
+						c(ctx)
+					}
+					return nil, err
+				}
+				afterListeners[k] = a
+				closers = append(closers, func(ctx context.Context) { a.Close() })
+			}
+		}
 		im = NewCacheWithEventListener[T](
 			entityDeps.BeforeListeners,
-			entityDeps.AfterListeners,
+			afterListeners,
 			entityDeps.Notify,
 		)
 		cache = im.Cache
-		handler = im.EventListener
+		head = im.EventListener
+		var match func(v T) bool
+		if entityDeps.Filter != nil {
+			match = entityDeps.Filter.Match
+		}
+		if entityDeps.SoftDelete {
+			filterMatch := match
+			match = func(v T) bool {
+				return !isDeleted(v) && (filterMatch == nil || filterMatch(v))
+			}
+		}
+		if match != nil {
+			filtered = newFilteredHandler[T](im.EventListener, im.Cache, im.AwaitNotify, match)
+			head = filtered
+		}
+		if entityDeps.SoftDelete {
+			soft = newSoftDeleteHandler[T](head, im.Cache, im.AwaitNotify)
+			head = soft
+		}
+		handler = head
 	} else {
 		handler = &noOpHandler[T]{}
 	}
@@ -213,33 +552,114 @@ func NewInMemory[T d](ctx context.Context, stream stream, deps MongoDeps, entity
 		cache,
 		handler,
 	)
+	if len(entityDeps.Fields) > 0 {
+		projection := mongo.NewProjection(entityDeps.Fields)
+		m.SetProjection(projection)
+		if im != nil {
+			im.Fields = projection.Fields()
+		}
+	}
+	if entityDeps.FullDocument || entityDeps.PreImages {
+		m.SetImages(mongo.Images{
+			FullDocument: entityDeps.FullDocument,
+			PreImages:    entityDeps.PreImages,
+		})
+	}
+	if entityDeps.OnCollectionEvent != nil {
+		m.SetOnCollectionEvent(entityDeps.OnCollectionEvent)
+	}
+	m.SetHooks(entityDeps.Hooks)
+	if filtered != nil {
+		filtered.lookup = func(ctx context.Context, filter bson.M) (item T, found bool, err error) {
+			if entityDeps.Filter != nil && entityDeps.Filter.BSON != nil {
+				filter = bson.M{"$and": bson.A{filter, entityDeps.Filter.BSON}}
+			}
+			return m.Searcher.FindOneWithFilter(ctx, filter)
+		}
+		switch {
+		case entityDeps.Filter == nil:
+			filtered.keys = map[string]bool{}
+		case entityDeps.Filter.BSON != nil:
+			filtered.keys = filterKeys(entityDeps.Filter.BSON)
+		}
+		if filtered.keys != nil && entityDeps.SoftDelete {
+			filtered.keys["deleted"] = true
+		}
+	}
 	if isStreamValid(stream) {
-		stream.AddListener(ctx, deps.Db, entityDeps.Collection, m.Listener)
+		if fs, ok := stream.(filteredStream); ok && entityDeps.StreamFilter != nil {
+			fs.AddListenerWithFilter(ctx, deps.Db, entityDeps.Collection, m.Listener, *entityDeps.StreamFilter)
+		} else {
+			stream.AddListener(ctx, deps.Db, entityDeps.Collection, m.Listener)
+		}
+		if rs, ok := stream.(removableStream); ok {
+			// The projection is detached from the Stream before its listeners are closed.
+			closers = append([]func(ctx context.Context){func(ctx context.Context) {
+				rs.RemoveListener(ctx, deps.Db, entityDeps.Collection, m.Listener)
+			}}, closers...)
+		}
 	}
 	i := inMemory[T]{
 		CacheWithEventListener: im,
 		Mongo:                  m,
+		handler:                head,
+		soft:                   soft,
+		closers:                closers,
+		load: func(ctx context.Context) (its []T, err error) {
+			if filter := warmupFilter(entityDeps); filter != nil {
+				return m.Searcher.FindWithFilter(ctx, filter)
+			}
+			return m.Searcher.All(ctx)
+		},
 	}
 	if entityDeps.Option != nil {
 		entityDeps.Option(&i)
 	}
+	if entityDeps.Refs != nil && im != nil {
+		if err := i.registerRefs(entityDeps.Refs, entityDeps.Collection); err != nil {
+			return nil, err
+		}
+	}
 	zerolog.Ctx(ctx).Debug().Str("collection", entityDeps.Collection).Any("im", im).Msg("in-memory initialized")
 	if im != nil {
-		var (
-			its []T
-			err error
-		)
-		if entityDeps.WarmupFilter != nil {
-			its, err = m.Searcher.FindWithFilter(ctx, *entityDeps.WarmupFilter)
-		} else {
-			its, err = m.Searcher.All(ctx)
-		}
+		its, err := i.load(ctx)
 		if err != nil {
 			return nil, err
 		}
 		for _, it := range its {
+			if soft != nil && isDeleted(it) {
+				soft.deleted.Add(ctx, it)
+				continue
+			}
+			if filtered != nil && !filtered.match(it) {
+				continue
+			}
 			im.EventListener.Add(ctx, it)
 		}
+		// Registered after the initial load, which is not a change.
+		if entityDeps.Audit != nil {
+			im.EventListener.AddChangeListener(entityDeps.Audit)
+			i.audit = entityDeps.Audit
+		}
 	}
 	return &i, nil
 }
+
+// warmupFilter combines WarmupFilter and the projection Filter into the filter of the initial load.
+// Returns nil if the entire collection should be loaded.
+func warmupFilter[T d](entityDeps Entity[T]) bson.M {
+	var filters bson.A
+	if entityDeps.WarmupFilter != nil {
+		filters = append(filters, *entityDeps.WarmupFilter)
+	}
+	if entityDeps.Filter != nil && entityDeps.Filter.BSON != nil {
+		filters = append(filters, entityDeps.Filter.BSON)
+	}
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0].(bson.M)
+	}
+	return bson.M{"$and": filters}
+}
@@ -0,0 +1,179 @@
+package inmemory
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// FieldChangeCallback is called with the old and new values of a watched field of an entity.
+// Pointers are dereferenced; a missing value (nil pointer, absent entity or path) is nil.
+type FieldChangeCallback func(ctx context.Context, id string, old, new any)
+
+// fieldSubscriptions dispatches the changes of entities to the subscriptions of their fields:
+// the value of each watched path whose top-level key is present in the change is extracted once and compared,
+// and only the callbacks of the changed paths are called.
+type fieldSubscriptions struct {
+	mu    sync.RWMutex
+	paths map[string]map[string]FieldChangeCallback // path -> subscription ID -> callback
+}
+
+func (s *fieldSubscriptions) empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.paths) == 0
+}
+
+func (s *fieldSubscriptions) add(path string, callback FieldChangeCallback) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paths == nil {
+		s.paths = map[string]map[string]FieldChangeCallback{}
+	}
+	if s.paths[path] == nil {
+		s.paths[path] = map[string]FieldChangeCallback{}
+	}
+	ui := uuid.NewString()
+	s.paths[path][ui] = callback
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.paths[path], ui)
+		if len(s.paths[path]) == 0 {
+			delete(s.paths, path)
+		}
+	}
+}
+
+// dispatch calls the callbacks of the changed paths. Paths whose top-level key is not in keys are skipped
+// without being evaluated; a nil keys evaluates every path.
+func (s *fieldSubscriptions) dispatch(ctx context.Context, id string, before, after any, keys map[string]bool) {
+	type call struct {
+		callbacks []FieldChangeCallback
+		old, new  any
+	}
+	var calls []call
+	s.mu.RLock()
+	for path, subs := range s.paths {
+		if keys != nil && !keys[topKey(path)] {
+			continue
+		}
+		o, _ := fieldValue(before, path)
+		n, _ := fieldValue(after, path)
+		if reflect.DeepEqual(o, n) {
+			continue
+		}
+		c := call{old: o, new: n}
+		for _, cb := range subs {
+			c.callbacks = append(c.callbacks, cb)
+		}
+		calls = append(calls, c)
+	}
+	s.mu.RUnlock()
+	for _, c := range calls {
+		for _, cb := range c.callbacks {
+			cb(ctx, id, c.old, c.new)
+		}
+	}
+}
+
+// OnFieldChange subscribes to the changes of a field of the entities, given by its dotted bson path
+// (e.g. "status", "address.city" or "items.0.count"). The callback is called after the cache is changed,
+// with the old and new values taken from the cached states, only when the value changes:
+// an insert reports a nil old value and a delete a nil new value. It returns a function which unsubscribes.
+func (c *Listener[T]) OnFieldChange(path string, callback FieldChangeCallback) (unsubscribe func()) {
+	return c.fields.add(path, callback)
+}
+
+// presentKeys returns the top-level keys of the fields present in an update event and of its removed fields,
+// or nil if the present fields are unknown.
+func presentKeys(fields, removedFields []string) map[string]bool {
+	if fields == nil {
+		return nil
+	}
+	keys := make(map[string]bool, len(fields)+len(removedFields))
+	for _, f := range fields {
+		keys[topKey(f)] = true
+	}
+	for _, f := range removedFields {
+		keys[topKey(f)] = true
+	}
+	return keys
+}
+
+// topKey returns the first segment of a dotted path.
+func topKey(path string) string {
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// fieldValue returns the value at the dotted bson path of v, with pointers dereferenced.
+func fieldValue(v any, path string) (value any, found bool) {
+	rv := reflect.ValueOf(v)
+	for _, segment := range strings.Split(path, ".") {
+		rv, found = fieldSegment(rv, segment)
+		if !found {
+			return nil, false
+		}
+	}
+	rv = deref(rv)
+	if !rv.IsValid() {
+		return nil, true
+	}
+	return rv.Interface(), true
+}
+
+func fieldSegment(rv reflect.Value, segment string) (reflect.Value, bool) {
+	rv = deref(rv)
+	if !rv.IsValid() {
+		return rv, false
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		rt := rv.Type()
+		for i := 0; i < rv.NumField(); i++ {
+			if !rt.Field(i).IsExported() {
+				continue
+			}
+			key := bsonKey(rt.Field(i))
+			if key == "" && rt.Field(i).Anonymous {
+				if f, ok := fieldSegment(rv.Field(i), segment); ok {
+					return f, true
+				}
+				continue
+			}
+			if key == segment {
+				return rv.Field(i), true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= rv.Len() {
+			return reflect.Value{}, false
+		}
+		return rv.Index(i), true
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		f := rv.MapIndex(reflect.ValueOf(segment).Convert(rv.Type().Key()))
+		return f, f.IsValid()
+	}
+	return reflect.Value{}, false
+}
+
+func deref(rv reflect.Value) reflect.Value {
+	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
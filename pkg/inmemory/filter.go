@@ -0,0 +1,275 @@
+package inmemory
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Filter is a projection predicate: only documents matching it are kept in the cache and indexes.
+// It is expressed both as a MongoDB filter (used for the initial load and for lookups)
+// and as an in-memory Go predicate (evaluated on every Change Stream event).
+// Both forms must describe the same set of documents.
+type Filter[T d] struct {
+	BSON  bson.M
+	Match func(v T) bool
+}
+
+// filteredHandler keeps the projection consistent with a Filter.
+// Documents that stop matching after an update are evicted from the cache and all indexes,
+// documents that start matching are looked up in MongoDB and added. An update of a document which is not cached
+// is looked up only if it changes a field of the filter (all updates if the fields of the filter are unknown).
+// Events which do not reach the projection are still passed to the await notifier,
+// so Await* operations on documents outside the filter do not block.
+type filteredHandler[T d] struct {
+	next   StreamEventListener[T]
+	cache  Cache[T]
+	notify Notify[T]
+	match  func(v T) bool
+	lookup func(ctx context.Context, filter bson.M) (item T, found bool, err error)
+	keys   map[string]bool // top-level fields of the filter, nil if unknown
+}
+
+func newFilteredHandler[T d](
+	next StreamEventListener[T],
+	cache Cache[T],
+	notify Notify[T],
+	match func(v T) bool,
+) *filteredHandler[T] {
+	return &filteredHandler[T]{
+		next:   next,
+		cache:  cache,
+		notify: notify,
+		match:  match,
+	}
+}
+
+func (s *filteredHandler[T]) cached(id string) bool {
+	_, found := s.cache.GetIndexByID(id)
+	return found
+}
+
+// Add ...
+func (s *filteredHandler[T]) Add(ctx context.Context, v T) {
+	if s.match(v) {
+		s.next.Add(ctx, v)
+		return
+	}
+	if s.cached(v.ID()) {
+		_id, err := primitive.ObjectIDFromHex(v.ID())
+		if err == nil {
+			s.next.Delete(ctx, _id)
+		}
+	}
+	s.notify.Add(ctx, v)
+}
+
+// Replace ...
+func (s *filteredHandler[T]) Replace(ctx context.Context, v T) {
+	if s.match(v) {
+		if r, ok := s.next.(interface {
+			Replace(ctx context.Context, v T)
+		}); ok {
+			r.Replace(ctx, v)
+			return
+		}
+		s.next.Add(ctx, v)
+		return
+	}
+	_id, err := primitive.ObjectIDFromHex(v.ID())
+	if err != nil {
+		return
+	}
+	if s.cached(v.ID()) {
+		s.next.Delete(ctx, _id)
+	}
+	s.notify.Update(ctx, _id, v, nil)
+}
+
+// ReplaceWithPreImage ...
+func (s *filteredHandler[T]) ReplaceWithPreImage(ctx context.Context, before, v T) {
+	if r, ok := s.next.(interface {
+		ReplaceWithPreImage(ctx context.Context, before, v T)
+	}); ok && s.match(v) {
+		r.ReplaceWithPreImage(ctx, before, v)
+		return
+	}
+	s.Replace(ctx, v)
+}
+
+// DeleteWithPreImage ...
+func (s *filteredHandler[T]) DeleteWithPreImage(ctx context.Context, _id primitive.ObjectID, before T) {
+	if r, ok := s.next.(interface {
+		DeleteWithPreImage(ctx context.Context, _id primitive.ObjectID, before T)
+	}); ok && s.cached(_id.Hex()) {
+		r.DeleteWithPreImage(ctx, _id, before)
+		return
+	}
+	s.Delete(ctx, _id)
+}
+
+// Clear ...
+func (s *filteredHandler[T]) Clear(ctx context.Context) {
+	if c, ok := s.next.(interface{ Clear(ctx context.Context) }); ok {
+		c.Clear(ctx)
+	}
+}
+
+// Update ...
+func (s *filteredHandler[T]) Update(ctx context.Context, _id primitive.ObjectID, updatedFields T, removedFields []string) {
+	s.UpdateFields(ctx, _id, updatedFields, nil, removedFields)
+}
+
+// UpdateFields ...
+func (s *filteredHandler[T]) UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string) {
+	s.updateFields(ctx, _id, nil, updatedFields, fields, removedFields)
+}
+
+// UpdateFieldsWithPreImage ...
+func (s *filteredHandler[T]) UpdateFieldsWithPreImage(ctx context.Context, _id primitive.ObjectID, before, updatedFields T, fields []string, removedFields []string) {
+	s.updateFields(ctx, _id, &before, updatedFields, fields, removedFields)
+}
+
+func (s *filteredHandler[T]) updateFields(ctx context.Context, _id primitive.ObjectID, pre *T, updatedFields T, fields []string, removedFields []string) {
+	if s.cached(_id.Hex()) {
+		if u, ok := s.next.(interface {
+			UpdateFieldsWithPreImage(ctx context.Context, _id primitive.ObjectID, before, updatedFields T, fields []string, removedFields []string)
+		}); ok && pre != nil {
+			u.UpdateFieldsWithPreImage(ctx, _id, *pre, updatedFields, fields, removedFields)
+		} else if u, ok := s.next.(interface {
+			UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string)
+		}); ok && fields != nil {
+			u.UpdateFields(ctx, _id, updatedFields, fields, removedFields)
+		} else {
+			s.next.Update(ctx, _id, updatedFields, removedFields)
+		}
+		if it, found := s.cache.Get(ctx, _id.Hex()); found && !s.match(it) {
+			s.next.Delete(ctx, _id)
+		}
+		return
+	}
+	if s.lookup != nil && s.mayMatch(fields, removedFields) {
+		it, found, err := s.lookup(ctx, bson.M{"_id": _id})
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("id", _id.Hex()).Msg("filtered projection: lookup updated document")
+		} else if found && s.match(it) {
+			s.next.Add(ctx, it)
+		}
+	}
+	s.notify.Update(ctx, _id, updatedFields, removedFields)
+}
+
+// mayMatch reports whether an update of the fields may make a document which is not cached match the filter:
+// a document which does not match can only start matching when a field of the filter changes.
+func (s *filteredHandler[T]) mayMatch(fields, removedFields []string) bool {
+	present := presentKeys(fields, removedFields)
+	if s.keys == nil || present == nil {
+		return true
+	}
+	for key := range present {
+		if s.keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// filterKeys returns the top-level fields a MongoDB filter depends on, walking $and, $or and $nor.
+// It returns nil if they are unknown, e.g. for $expr or $where.
+func filterKeys(filter any) map[string]bool {
+	keys := map[string]bool{}
+	if !collectFilterKeys(filter, keys) {
+		return nil
+	}
+	return keys
+}
+
+func collectFilterKeys(filter any, keys map[string]bool) bool {
+	var elements bson.D
+	switch f := filter.(type) {
+	case bson.M:
+		for k, v := range f {
+			elements = append(elements, bson.E{Key: k, Value: v})
+		}
+	case map[string]any:
+		for k, v := range f {
+			elements = append(elements, bson.E{Key: k, Value: v})
+		}
+	case bson.D:
+		elements = f
+	default:
+		return false
+	}
+	for _, e := range elements {
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			var clauses []any
+			switch c := e.Value.(type) {
+			case bson.A:
+				clauses = c
+			case []bson.M:
+				for _, it := range c {
+					clauses = append(clauses, it)
+				}
+			case []bson.D:
+				for _, it := range c {
+					clauses = append(clauses, it)
+				}
+			default:
+				return false
+			}
+			for _, c := range clauses {
+				if !collectFilterKeys(c, keys) {
+					return false
+				}
+			}
+		default:
+			if strings.HasPrefix(e.Key, "$") {
+				return false
+			}
+			keys[topKey(e.Key)] = true
+		}
+	}
+	return true
+}
+
+// Patch ...
+func (s *filteredHandler[T]) Patch(ctx context.Context, _id primitive.ObjectID, patch *mongo.Patch) (applied bool) {
+	p, ok := s.next.(interface {
+		Patch(ctx context.Context, _id primitive.ObjectID, patch *mongo.Patch) (applied bool)
+	})
+	if !ok || !s.cached(_id.Hex()) || !p.Patch(ctx, _id, patch) {
+		return
+	}
+	if it, found := s.cache.Get(ctx, _id.Hex()); found && !s.match(it) {
+		s.next.Delete(ctx, _id)
+	}
+	return true
+}
+
+// PatchWithPreImage ...
+func (s *filteredHandler[T]) PatchWithPreImage(ctx context.Context, _id primitive.ObjectID, before T, patch *mongo.Patch) (applied bool) {
+	p, ok := s.next.(interface {
+		PatchWithPreImage(ctx context.Context, _id primitive.ObjectID, before T, patch *mongo.Patch) (applied bool)
+	})
+	if !ok || !s.cached(_id.Hex()) || !p.PatchWithPreImage(ctx, _id, before, patch) {
+		return
+	}
+	if it, found := s.cache.Get(ctx, _id.Hex()); found && !s.match(it) {
+		s.next.Delete(ctx, _id)
+	}
+	return true
+}
+
+// Delete ...
+func (s *filteredHandler[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
+	if s.cached(_id.Hex()) {
+		s.next.Delete(ctx, _id)
+		return
+	}
+	s.notify.Delete(ctx, _id)
+}
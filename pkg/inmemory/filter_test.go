@@ -0,0 +1,74 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilteredHandler(t *testing.T) {
+	ctx := context.Background()
+	png, jpg := "png", "jpg"
+	orig := "orig"
+	c := NewCacheWithEventListener[*Image](nil, nil, nil)
+	h := newFilteredHandler[*Image](c.EventListener, c.Cache, c.AwaitNotify, func(v *Image) bool {
+		return v.Mime != nil && *v.Mime == png
+	})
+	stored := map[primitive.ObjectID]*Image{}
+	lookups := 0
+	h.lookup = func(ctx context.Context, filter bson.M) (*Image, bool, error) {
+		lookups++
+		it, found := stored[filter["_id"].(primitive.ObjectID)]
+		return it, found, nil
+	}
+	h.keys = filterKeys(bson.M{"mime": png})
+
+	skipped := &Image{Mime: &jpg, Orig: &orig}
+	h.Add(ctx, skipped)
+	_, found := c.Cache.Get(ctx, skipped.ID())
+	assert.False(t, found)
+
+	matched := &Image{Mime: &png, Orig: &orig}
+	h.Add(ctx, matched)
+	_, found = c.Cache.Get(ctx, matched.ID())
+	assert.True(t, found)
+	assert.Equal(t, []string{matched.ID()}, c.InverseIndexes["orig"].Get(ctx, &orig))
+
+	// stops matching: evicted from the cache and indexes
+	h.Update(ctx, matched.Id, &Image{Mime: &jpg}, nil)
+	_, found = c.Cache.Get(ctx, matched.ID())
+	assert.False(t, found)
+	assert.Empty(t, c.InverseIndexes["orig"].Get(ctx, &orig))
+
+	// fields of the filter unchanged: not looked up
+	h.UpdateFields(ctx, skipped.Id, &Image{Orig: &orig}, []string{"orig"}, nil)
+	assert.Equal(t, 0, lookups)
+
+	// starts matching: looked up and added
+	stored[skipped.Id] = &Image{D: D{Id: skipped.Id}, Mime: &png, Orig: &orig}
+	notified := false
+	c.AwaitNotify.AddListenerUpdate(skipped.ID(), func() { notified = true })
+	h.Update(ctx, skipped.Id, &Image{Mime: &png}, nil)
+	it, found := c.Cache.Get(ctx, skipped.ID())
+	assert.True(t, found)
+	assert.Equal(t, png, *it.Mime)
+	assert.Equal(t, []string{skipped.ID()}, c.InverseIndexes["orig"].Get(ctx, &orig))
+	assert.True(t, notified)
+
+	// delete of a document outside the filter still releases waiters
+	notified = false
+	c.AwaitNotify.AddListenerDelete(matched.ID(), func() { notified = true })
+	h.Delete(ctx, matched.Id)
+	assert.True(t, notified)
+}
+
+func TestFilterKeys(t *testing.T) {
+	assert.Equal(t, map[string]bool{"mime": true, "orig": true, "address": true}, filterKeys(bson.M{
+		"mime": "png",
+		"$or":  bson.A{bson.M{"orig": nil}, bson.D{{Key: "address.city", Value: "Paris"}}},
+	}))
+	assert.Nil(t, filterKeys(bson.M{"$expr": bson.M{"$gt": bson.A{"$width", "$height"}}}))
+}
@@ -236,3 +236,94 @@ func _updateStringFieldValuesByName(in any, fields []string) []string {
 	}
 	return append([]string{}, strings.Join(res, ""))
 }
+
+// presentAsRemoved returns the removed fields of an update with the fields present in it: an index key field
+// present with a zero or null value has no key, so it is unset like a removed field.
+func presentAsRemoved(fields []string, removedFields []string) []string {
+	return append(removedFields[:len(removedFields):len(removedFields)], fields...)
+}
+
+// isFieldRemoved reports whether one of the index fields (Go field names, "+" separated for nested fields)
+// is listed in removedFields (bson names) of an update. A removed parent document removes its nested fields too.
+func isFieldRemoved(in any, fields []string, removedFields []string) bool {
+	if len(removedFields) == 0 {
+		return false
+	}
+	t := reflect.TypeOf(in)
+	for _, f := range fields {
+		path := bsonPathByName(t, f)
+		if path == "" {
+			continue
+		}
+		for _, r := range removedFields {
+			if r == path || strings.HasPrefix(path, r+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bsonPathByName converts a "+" separated Go field path to a dotted bson path.
+// Untagged struct fields are inlined, as in the cache.
+func bsonPathByName(t reflect.Type, field string) string {
+	var path []string
+	for _, name := range strings.Split(field, "+") {
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			return ""
+		}
+		sf, ok := t.FieldByName(name)
+		if !ok {
+			return ""
+		}
+		key := strings.SplitN(sf.Tag.Get("bson"), ",", 2)[0]
+		if key != "" && key != "-" {
+			path = append(path, key)
+		}
+		t = sf.Type
+	}
+	return strings.Join(path, ".")
+}
+
+// nilFields returns the bson names of the top-level fields of v which are nil,
+// so that a full entity passed as updatedFields also clears the fields it no longer has.
+func nilFields(v any) (fields []string) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	rt := rv.Type()
+	for i := 0; i < rv.NumField(); i++ {
+		key := bsonKey(rt.Field(i))
+		if key == "" || key == "-" {
+			continue
+		}
+		switch rv.Field(i).Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			if rv.Field(i).IsNil() {
+				fields = append(fields, key)
+			}
+		}
+	}
+	return
+}
+
+// bsonKey returns the bson key name of a struct field (the first comma-separated segment of its tag).
+func bsonKey(f reflect.StructField) string {
+	tag := f.Tag.Get("bson")
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == ',' {
+			return tag[:i]
+		}
+	}
+	return tag
+}
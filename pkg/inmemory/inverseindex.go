@@ -76,15 +76,15 @@ func (s *inverseIndex[T]) Add(ctx context.Context, it T) {
 }
 
 // Update updates the index when entity fields change.
-// Note: If a field from the index key (s.from) is removed (becomes nil),
-// the index entry is not automatically removed. This is a known limitation.
-// The index will be updated correctly on the next full resync or when the entity
-// is recreated with the field populated.
+// If a field from the index key (s.from) is listed in removedFields, the entity is moved to the nil values.
 func (s *inverseIndex[T]) Update(ctx context.Context, id primitive.ObjectID, updatedFields T, removedFields []string) {
 	s.Lock()
 	defer s.Unlock()
 	updatedVal := updateStringFieldValuesByName(updatedFields, s.from)
 	if updatedVal == nil {
+		if isFieldRemoved(updatedFields, s.from, removedFields) {
+			s.unset(ctx, id)
+		}
 		return
 	}
 	if it, found := s.cache.Get(ctx, id.Hex()); found {
@@ -117,6 +117,38 @@ func (s *inverseIndex[T]) Update(ctx context.Context, id primitive.ObjectID, upd
 	}
 }
 
+// UpdateFields updates the index like Update; a key field present in the event with a zero or null value
+// moves the entity to the nil values.
+func (s *inverseIndex[T]) UpdateFields(ctx context.Context, id primitive.ObjectID, updatedFields T, fields []string, removedFields []string) {
+	s.Update(ctx, id, updatedFields, presentAsRemoved(fields, removedFields))
+}
+
+// unset moves the entity from the values of its current key to the nil values.
+func (s *inverseIndex[T]) unset(ctx context.Context, id primitive.ObjectID) {
+	it, found := s.cache.Get(ctx, id.Hex())
+	if !found {
+		return
+	}
+	fromVal := updateStringFieldValuesByName(it, s.from)
+	if fromVal == nil {
+		return
+	}
+	to := it.ID()
+	if s.to != nil {
+		_to := updateStringFieldValueByName(it, *s.to)
+		if _to != nil {
+			to = *_to
+		}
+	}
+	for k, d := range s.data[*fromVal] {
+		if d == to {
+			s.data[*fromVal] = append(s.data[*fromVal][:k], s.data[*fromVal][k+1:]...)
+			break
+		}
+	}
+	s.nilData = append(s.nilData, to)
+}
+
 // Delete ...
 func (s *inverseIndex[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
 	s.Lock()
@@ -66,6 +66,14 @@ func (s *inverseUniqueIndex[T]) Update(ctx context.Context, id primitive.ObjectI
 	defer s.Unlock()
 	updatedVal := _updateStringFieldValuesByName(updatedFields, s.from)
 	if len(updatedVal) == 0 {
+		if !isFieldRemoved(updatedFields, s.from, removedFields) {
+			return
+		}
+		if it, found := s.cache.Get(ctx, id.Hex()); found {
+			for _, fv := range _updateStringFieldValuesByName(it, s.from) {
+				delete(s.data, fv)
+			}
+		}
 		return
 	}
 	if it, found := s.cache.Get(ctx, id.Hex()); found {
@@ -100,6 +108,12 @@ func (s *inverseUniqueIndex[T]) Update(ctx context.Context, id primitive.ObjectI
 	}
 }
 
+// UpdateFields updates the index like Update; a key field present in the event with a zero or null value
+// removes the entity from the index.
+func (s *inverseUniqueIndex[T]) UpdateFields(ctx context.Context, id primitive.ObjectID, updatedFields T, fields []string, removedFields []string) {
+	s.Update(ctx, id, updatedFields, presentAsRemoved(fields, removedFields))
+}
+
 // Delete ...
 func (s *inverseUniqueIndex[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
 	s.Lock()
@@ -3,6 +3,8 @@ package inmemory
 import (
 	"context"
 
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,20 +16,53 @@ type StreamEventListener[T d] interface {
 	Delete(ctx context.Context, _id primitive.ObjectID)
 }
 
+// UpdateFieldsListener is implemented by StreamEventListeners which handle an update with the bson names
+// of the top-level fields present in the event (see Listener.UpdateFields), so fields set to a zero value
+// or null are told apart from absent ones (e.g. indexes unsetting such key fields).
+type UpdateFieldsListener[T d] interface {
+	UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string)
+}
+
+// Change describes a change of an entity with its exact states before and after it.
+// HasBefore is false for inserts and HasAfter is false for deletes.
+// Before is taken from the cache, or from the MongoDB pre-image when it is available (see mongo.Images).
+type Change[T d] struct {
+	ID        string
+	Before    T
+	HasBefore bool
+	After     T
+	HasAfter  bool
+}
+
+// ChangeListener receives changes of entities with their exact old and new states.
+// It is called after the cache is changed and before the after listeners.
+type ChangeListener[T d] interface {
+	Change(ctx context.Context, change Change[T])
+}
+
 // Listener coordinates multiple StreamEventListeners and manages the execution order.
 // BeforeListeners are called before cache operations, regular listeners are called after.
 type Listener[T d] struct {
 	cache           Cache[T]
 	listeners       []StreamEventListener[T]
 	beforeListeners []StreamEventListener[T]
+	changeListeners []ChangeListener[T]
+	fields          fieldSubscriptions
+	queries         querySubscriptions[T]
 }
 
 // Add processes an Add event by calling before listeners, updating the cache, then calling after listeners.
 func (c *Listener[T]) Add(ctx context.Context, v T) {
+	c.add(ctx, v, nil)
+}
+
+func (c *Listener[T]) add(ctx context.Context, v T, pre *T) {
+	before, hasBefore := c.before(ctx, v.ID(), pre)
 	for _, listener := range c.beforeListeners {
 		listener.Add(ctx, v)
 	}
 	c.cache.Add(ctx, v)
+	c.changed(ctx, v.ID(), before, hasBefore, nil)
 	for _, listener := range c.listeners {
 		listener.Add(ctx, v)
 	}
@@ -35,26 +70,167 @@ func (c *Listener[T]) Add(ctx context.Context, v T) {
 
 // Update processes an Update event by calling before listeners, updating the cache, then calling after listeners.
 func (c *Listener[T]) Update(ctx context.Context, _id primitive.ObjectID, updatedFields T, removedFields []string) {
+	c.update(ctx, _id, updatedFields, nil, removedFields, nil)
+}
+
+// UpdateFields processes an Update event like Update, changing in the cache only the fields present in the event
+// (bson names of the top-level keys of updatedFields), whatever their value (see Cache.UpdateFields).
+func (c *Listener[T]) UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string) {
+	c.update(ctx, _id, updatedFields, fields, removedFields, nil)
+}
+
+func (c *Listener[T]) update(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string, pre *T) {
+	before, hasBefore := c.before(ctx, _id.Hex(), pre)
 	for _, listener := range c.beforeListeners {
+		if u, ok := listener.(UpdateFieldsListener[T]); ok && fields != nil {
+			u.UpdateFields(ctx, _id, updatedFields, fields, removedFields)
+			continue
+		}
 		listener.Update(ctx, _id, updatedFields, removedFields)
 	}
-	c.cache.Update(ctx, _id, updatedFields, removedFields)
+	c.cache.UpdateFields(ctx, _id, updatedFields, fields, removedFields)
+	c.changed(ctx, _id.Hex(), before, hasBefore, presentKeys(fields, removedFields))
 	for _, listener := range c.listeners {
 		listener.Update(ctx, _id, updatedFields, removedFields)
 	}
 }
 
+// UpdateFieldsWithPreImage processes an Update event like UpdateFields,
+// passing the MongoDB pre-image to change listeners as the old state.
+func (c *Listener[T]) UpdateFieldsWithPreImage(ctx context.Context, _id primitive.ObjectID, before, updatedFields T, fields []string, removedFields []string) {
+	c.update(ctx, _id, updatedFields, fields, removedFields, &before)
+}
+
 // Delete processes a Delete event by calling before listeners, deleting from the cache, then calling after listeners.
 func (c *Listener[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
+	c.delete(ctx, _id, nil)
+}
+
+func (c *Listener[T]) delete(ctx context.Context, _id primitive.ObjectID, pre *T) {
+	before, hasBefore := c.before(ctx, _id.Hex(), pre)
 	for _, listener := range c.beforeListeners {
 		listener.Delete(ctx, _id)
 	}
 	c.cache.Delete(ctx, _id)
+	c.changed(ctx, _id.Hex(), before, hasBefore, nil)
 	for _, listener := range c.listeners {
 		listener.Delete(ctx, _id)
 	}
 }
 
+// Replace processes a replace event as a full document swap.
+// If the entity is cached, it is applied as an Update with the whole document, clearing the fields it no longer has;
+// otherwise it is processed as an Add.
+func (c *Listener[T]) Replace(ctx context.Context, v T) {
+	c.replace(ctx, v, nil)
+}
+
+// ReplaceWithPreImage processes a full document swap like Replace,
+// passing the MongoDB pre-image to change listeners as the old state.
+func (c *Listener[T]) ReplaceWithPreImage(ctx context.Context, before, v T) {
+	c.replace(ctx, v, &before)
+}
+
+// DeleteWithPreImage processes a Delete event like Delete,
+// passing the MongoDB pre-image to change listeners as the old state.
+func (c *Listener[T]) DeleteWithPreImage(ctx context.Context, _id primitive.ObjectID, before T) {
+	c.delete(ctx, _id, &before)
+}
+
+// Patch applies the dotted paths and truncated arrays of an update event to the cached entity
+// and processes the result as a full document swap (see Replace).
+// It reports false if the entity is not cached or the patch cannot be applied.
+func (c *Listener[T]) Patch(ctx context.Context, _id primitive.ObjectID, patch *mongo.Patch) (applied bool) {
+	it, found := c.cache.Get(ctx, _id.Hex())
+	if !found {
+		return
+	}
+	patched, err := mongo.ApplyPatch(it, patch)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("id", _id.Hex()).Msg("patch cached entity")
+		return
+	}
+	c.replace(ctx, patched, nil)
+	return true
+}
+
+// PatchWithPreImage applies the dotted paths and truncated arrays of an update event to the MongoDB pre-image
+// and processes the result as a full document swap, passing the pre-image to change listeners as the old state.
+// It reports false if the patch cannot be applied.
+func (c *Listener[T]) PatchWithPreImage(ctx context.Context, _id primitive.ObjectID, before T, patch *mongo.Patch) (applied bool) {
+	patched, err := mongo.ApplyPatch(before, patch)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("id", _id.Hex()).Msg("patch pre-image")
+		return
+	}
+	c.replace(ctx, patched, &before)
+	return true
+}
+
+func (c *Listener[T]) replace(ctx context.Context, v T, pre *T) {
+	_id, err := primitive.ObjectIDFromHex(v.ID())
+	if _, cached := c.cache.GetIndexByID(v.ID()); !cached || err != nil {
+		c.add(ctx, v, pre)
+		return
+	}
+	c.update(ctx, _id, v, nil, nilFields(v), pre)
+}
+
+// before returns the old state of an entity for change listeners: the pre-image if any, otherwise the cached entity.
+func (c *Listener[T]) before(ctx context.Context, id string, pre *T) (before T, found bool) {
+	if !c.observed() {
+		return
+	}
+	if pre != nil {
+		return *pre, true
+	}
+	return c.cache.Get(ctx, id)
+}
+
+// observed reports whether changes have observers: change listeners, field or query subscriptions.
+func (c *Listener[T]) observed() bool {
+	return len(c.changeListeners) > 0 || !c.fields.empty() || !c.queries.empty()
+}
+
+// changed calls change listeners, field and query subscriptions with the old state and the new state
+// of the entity taken from the cache. Only the field subscriptions of the top-level keys present in the event
+// are evaluated; all of them if keys is nil.
+func (c *Listener[T]) changed(ctx context.Context, id string, before T, hasBefore bool, keys map[string]bool) {
+	if !c.observed() {
+		return
+	}
+	change := Change[T]{ID: id, Before: before, HasBefore: hasBefore}
+	change.After, change.HasAfter = c.cache.Get(ctx, id)
+	for _, listener := range c.changeListeners {
+		listener.Change(ctx, change)
+	}
+	if !c.fields.empty() {
+		var b, a any
+		if change.HasBefore {
+			b = change.Before
+		}
+		if change.HasAfter {
+			a = change.After
+		}
+		c.fields.dispatch(ctx, id, b, a, keys)
+	}
+	if !c.queries.empty() {
+		c.queries.dispatch(ctx, change)
+	}
+}
+
+// Clear removes every entity from the cache by processing a Delete event for each of them,
+// so indexes and listeners stay consistent. It is used after a collection drop, rename or invalidate event.
+func (c *Listener[T]) Clear(ctx context.Context) {
+	for _, id := range c.cache.All(ctx) {
+		_id, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		c.Delete(ctx, _id)
+	}
+}
+
 // AddListener registers a new StreamEventListener.
 // If before is true, the listener is called before cache operations; otherwise, it's called after.
 func (c *Listener[T]) AddListener(listener StreamEventListener[T], before bool) (idx int) {
@@ -66,6 +242,11 @@ func (c *Listener[T]) AddListener(listener StreamEventListener[T], before bool)
 	return
 }
 
+// AddChangeListener registers a ChangeListener.
+func (c *Listener[T]) AddChangeListener(listener ChangeListener[T]) {
+	c.changeListeners = append(c.changeListeners, listener)
+}
+
 // NewListener creates a new Listener that coordinates cache operations and event listeners.
 func NewListener[T d](cache Cache[T]) *Listener[T] {
 	return &Listener[T]{
@@ -75,6 +256,22 @@ func NewListener[T d](cache Cache[T]) *Listener[T] {
 	}
 }
 
+// ChangeCallbackListener is a ChangeListener that calls a callback function for every change.
+type ChangeCallbackListener[T d] struct {
+	callback func(ctx context.Context, change Change[T])
+}
+
+// NewChangeCallbackListener creates a new ChangeCallbackListener with the specified callback.
+func NewChangeCallbackListener[T d](callback func(ctx context.Context, change Change[T])) *ChangeCallbackListener[T] {
+	return &ChangeCallbackListener[T]{
+		callback: callback,
+	}
+}
+
+func (s *ChangeCallbackListener[T]) Change(ctx context.Context, change Change[T]) {
+	s.callback(ctx, change)
+}
+
 // AddCallbackListener is a StreamEventListener that calls a callback function only for Add events.
 type AddCallbackListener[T d] struct {
 	callback func(ctx context.Context, v T)
@@ -0,0 +1,239 @@
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+func TestListener_Replace(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Image](nil, nil, nil)
+	mime := "png"
+	img := &Image{Name: &name1, Orig: &parent1, Mime: &mime}
+	c.EventListener.Add(ctx, img)
+
+	c.EventListener.Replace(ctx, &Image{D: D{Id: img.Id}, Name: &name2})
+	it, found := c.Cache.Get(ctx, img.ID())
+	assert.True(t, found)
+	assert.Equal(t, name2, *it.Name)
+	assert.Nil(t, it.Orig)
+	assert.Nil(t, it.Mime)
+	assert.Empty(t, c.InverseIndexes["orig"].Get(ctx, &parent1))
+
+	other := &Image{Orig: &parent2}
+	c.EventListener.Replace(ctx, other)
+	assert.Equal(t, []string{other.ID()}, c.InverseIndexes["orig"].Get(ctx, &parent2))
+}
+
+func TestListener_UpdateFieldsIndexes(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Image](nil, nil, nil)
+	img := &Image{Name: &name1, Orig: &parent1}
+	c.EventListener.Add(ctx, img)
+	assert.Equal(t, []string{img.ID()}, c.SortedIndexes["title"].Intersect([]string{img.ID()}))
+
+	// Key fields present in the event with a null value are unset in the indexes, like the cache.
+	c.EventListener.UpdateFields(ctx, img.Id, &Image{}, []string{"name", "orig"}, nil)
+	it, found := c.Cache.Get(ctx, img.ID())
+	assert.True(t, found)
+	assert.Nil(t, it.Orig)
+	assert.Empty(t, c.InverseIndexes["orig"].Get(ctx, &parent1))
+	assert.Empty(t, c.SortedIndexes["title"].Intersect([]string{img.ID()}))
+}
+
+func TestListener_Clear(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Image](nil, nil, nil)
+	for _, p := range []*string{&parent1, &parent2} {
+		c.EventListener.Add(ctx, &Image{Orig: p})
+	}
+	deleted := 0
+	c.EventListener.AddListener(inmemory.NewDeleteCallbackListener[*Image](func(ctx context.Context, id string) {
+		deleted++
+	}), false)
+	c.EventListener.Clear(ctx)
+	assert.Empty(t, c.Cache.All(ctx))
+	assert.Empty(t, c.InverseIndexes["orig"].Get(ctx, &parent1))
+	assert.Empty(t, c.InverseIndexes["orig"].Get(ctx, &parent2))
+	assert.Equal(t, 2, deleted)
+}
+
+func TestListener_ChangeListener(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Image](nil, nil, nil)
+	var changes []inmemory.Change[*Image]
+	c.EventListener.AddChangeListener(inmemory.NewChangeCallbackListener[*Image](func(ctx context.Context, change inmemory.Change[*Image]) {
+		changes = append(changes, change)
+	}))
+	img := &Image{Name: &name1}
+	c.EventListener.Add(ctx, img)
+	c.EventListener.Replace(ctx, &Image{D: D{Id: img.Id}, Name: &name2})
+	c.EventListener.DeleteWithPreImage(ctx, img.Id, &Image{D: D{Id: img.Id}, Name: &parent1})
+
+	assert.Len(t, changes, 3)
+	assert.False(t, changes[0].HasBefore)
+	assert.Equal(t, name1, *changes[0].After.Name)
+	assert.Equal(t, name1, *changes[1].Before.Name)
+	assert.Equal(t, name2, *changes[1].After.Name)
+	assert.True(t, changes[2].HasBefore)
+	assert.Equal(t, parent1, *changes[2].Before.Name)
+	assert.False(t, changes[2].HasAfter)
+}
+
+type Profile struct {
+	Id      primitive.ObjectID `json:"_id" bson:"_id"`
+	Visits  *int               `json:"visits" bson:"visits"`
+	Address *Address           `json:"address" bson:"address"`
+	Tags    []string           `json:"tags" bson:"tags"`
+}
+
+type Address struct {
+	City *string `json:"city" bson:"city"`
+}
+
+func (v *Profile) ID() string {
+	return v.Id.Hex()
+}
+
+func (v *Profile) Version() *int64 {
+	return nil
+}
+
+func (v *Profile) SetDeleted(bool) {}
+
+func TestListener_Patch(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Profile](nil, nil, nil)
+	visits, city := 5, "Berlin"
+	p := &Profile{Id: primitive.NewObjectID(), Visits: &visits, Address: &Address{City: &city}, Tags: []string{"a", "b", "c"}}
+	c.EventListener.Add(ctx, p)
+
+	l := mongo.NewListener[*Profile]("profiles", c.EventListener)
+	assert.NoError(t, l.Listen(ctx, []byte(`{"operationType":"update","documentKey":{"_id":{"$oid":"`+p.ID()+`"}},`+
+		`"updateDescription":{"updatedFields":{"address.city":"Paris","tags.1":"x","visits":0},"removedFields":[],`+
+		`"truncatedArrays":[{"field":"tags","newSize":2}]}}`)))
+	it, found := c.Cache.Get(ctx, p.ID())
+	assert.True(t, found)
+	assert.Equal(t, "Paris", *it.Address.City)
+	assert.Equal(t, []string{"a", "x"}, it.Tags)
+	assert.Equal(t, 0, *it.Visits)
+}
+
+func TestListener_UpdatePreImage(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Profile](nil, nil, nil)
+	var changes []inmemory.Change[*Profile]
+	c.EventListener.AddChangeListener(inmemory.NewChangeCallbackListener[*Profile](func(ctx context.Context, change inmemory.Change[*Profile]) {
+		changes = append(changes, change)
+	}))
+	visits, city := 1, "Berlin"
+	p := &Profile{Id: primitive.NewObjectID(), Visits: &visits, Address: &Address{City: &city}}
+	c.EventListener.Add(ctx, p)
+
+	// Update events without a post-image pass the pre-image, not the cached state, as the old state.
+	l := mongo.NewListener[*Profile]("profiles", c.EventListener)
+	l.SetImages(mongo.Images{PreImages: true})
+	pre := `"fullDocumentBeforeChange":{"_id":{"$oid":"` + p.ID() + `"},"visits":5,"address":{"city":"Rome"}}`
+	assert.NoError(t, l.Listen(ctx, []byte(`{"operationType":"update","documentKey":{"_id":{"$oid":"`+p.ID()+`"}},`+
+		`"updateDescription":{"updatedFields":{"visits":6},"removedFields":[]},`+pre+`}`)))
+	assert.NoError(t, l.Listen(ctx, []byte(`{"operationType":"update","documentKey":{"_id":{"$oid":"`+p.ID()+`"}},`+
+		`"updateDescription":{"updatedFields":{"address.city":"Paris"},"removedFields":[]},`+pre+`}`)))
+	assert.Len(t, changes, 3)
+	assert.Equal(t, 5, *changes[1].Before.Visits)
+	assert.Equal(t, 6, *changes[1].After.Visits)
+	assert.Equal(t, "Rome", *changes[2].Before.Address.City)
+	assert.Equal(t, "Paris", *changes[2].After.Address.City)
+}
+
+func TestListener_OnFieldChange(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Profile](nil, nil, nil)
+	type fieldChange struct {
+		id       string
+		old, new any
+	}
+	var cities, tags []fieldChange
+	c.EventListener.OnFieldChange("address.city", func(ctx context.Context, id string, old, new any) {
+		cities = append(cities, fieldChange{id, old, new})
+	})
+	unsubscribe := c.EventListener.OnFieldChange("tags.0", func(ctx context.Context, id string, old, new any) {
+		tags = append(tags, fieldChange{id, old, new})
+	})
+
+	city, other := "Berlin", "Paris"
+	visits := 1
+	p := &Profile{Id: primitive.NewObjectID(), Address: &Address{City: &city}}
+	c.EventListener.Add(ctx, p)
+	assert.Equal(t, []fieldChange{{p.ID(), nil, city}}, cities)
+	assert.Empty(t, tags)
+
+	// other fields change: not called
+	c.EventListener.Update(ctx, p.Id, &Profile{Visits: &visits}, nil)
+	assert.Len(t, cities, 1)
+
+	c.EventListener.Update(ctx, p.Id, &Profile{Address: &Address{City: &other}, Tags: []string{"a"}}, nil)
+	assert.Equal(t, fieldChange{p.ID(), city, other}, cities[1])
+	assert.Equal(t, []fieldChange{{p.ID(), nil, "a"}}, tags)
+
+	// only the paths of the fields present in the event are evaluated, even if the pre-image differs elsewhere
+	l := c.EventListener.(*inmemory.Listener[*Profile])
+	l.UpdateFieldsWithPreImage(ctx, p.Id, &Profile{Id: p.Id, Address: &Address{City: &other}, Tags: []string{"b"}},
+		&Profile{Visits: &visits}, []string{"visits"}, nil)
+	assert.Len(t, cities, 2)
+	assert.Len(t, tags, 1)
+
+	unsubscribe()
+	c.EventListener.Delete(ctx, p.Id)
+	assert.Equal(t, fieldChange{p.ID(), other, nil}, cities[2])
+	assert.Len(t, tags, 1)
+}
+
+func TestListener_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCacheWithEventListener[*Profile](nil, nil, nil)
+	berlin, paris := "Berlin", "Paris"
+	visits := 1
+	p1 := &Profile{Id: primitive.NewObjectID(), Address: &Address{City: &berlin}}
+	p2 := &Profile{Id: primitive.NewObjectID(), Address: &Address{City: &paris}}
+	c.EventListener.Add(ctx, p1)
+	c.EventListener.Add(ctx, p2)
+
+	var events []inmemory.QueryEvent[*Profile]
+	snapshot, unsubscribe := c.EventListener.Subscribe(ctx, inmemory.FieldEquals[*Profile]("address.city", berlin),
+		func(ctx context.Context, event inmemory.QueryEvent[*Profile]) {
+			events = append(events, event)
+		})
+	assert.Equal(t, []*Profile{p1}, snapshot)
+
+	// a matching entity changes
+	c.EventListener.Update(ctx, p1.Id, &Profile{Visits: &visits}, nil)
+	assert.Len(t, events, 1)
+	assert.Equal(t, inmemory.Changed, events[0].Type)
+	assert.Equal(t, visits, *events[0].After.Visits)
+
+	// p2 enters, p1 leaves
+	c.EventListener.Update(ctx, p2.Id, &Profile{Address: &Address{City: &berlin}}, nil)
+	c.EventListener.Update(ctx, p1.Id, &Profile{Address: &Address{City: &paris}}, nil)
+	assert.Len(t, events, 3)
+	assert.Equal(t, inmemory.Entered, events[1].Type)
+	assert.Equal(t, p2.ID(), events[1].ID)
+	assert.Equal(t, inmemory.Left, events[2].Type)
+	assert.Equal(t, p1.ID(), events[2].ID)
+
+	// a non-matching entity changes: no event
+	c.EventListener.Update(ctx, p1.Id, &Profile{Visits: &visits}, nil)
+	assert.Len(t, events, 3)
+
+	c.EventListener.Delete(ctx, p2.Id)
+	assert.Equal(t, inmemory.Left, events[3].Type)
+
+	unsubscribe()
+	c.EventListener.Add(ctx, &Profile{Id: primitive.NewObjectID(), Address: &Address{City: &berlin}})
+	assert.Len(t, events, 4)
+}
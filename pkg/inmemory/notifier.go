@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -31,6 +32,8 @@ type Notifier[T d] struct {
 	listenersCreate map[string]map[string]func()
 	listenersUpdate map[string]map[string]func()
 	listenersDelete map[string]map[string]func()
+	listenersTxn    map[string]map[string]func(operationType, id string)
+	listenersBatch  map[string]func(operationType, id string)
 }
 
 // Add ...
@@ -43,6 +46,7 @@ func (s *Notifier[T]) Add(ctx context.Context, v T) {
 		}
 	}
 	delete(s.listenersCreate, v.ID())
+	s.notifyTxn(ctx, mongo.InsertOperationType, v.ID())
 }
 
 // Update ...
@@ -55,6 +59,7 @@ func (s *Notifier[T]) Update(ctx context.Context, _id primitive.ObjectID, update
 		}
 	}
 	delete(s.listenersUpdate, _id.Hex())
+	s.notifyTxn(ctx, mongo.UpdateOperationType, _id.Hex())
 }
 
 // Delete ...
@@ -67,6 +72,21 @@ func (s *Notifier[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
 		}
 	}
 	delete(s.listenersDelete, _id.Hex())
+	s.notifyTxn(ctx, mongo.DeleteOperationType, _id.Hex())
+}
+
+// notifyTxn calls the batch listeners and the listeners of the session of the transaction which produced the event, if any.
+func (s *Notifier[T]) notifyTxn(ctx context.Context, operationType, id string) {
+	for _, l := range s.listenersBatch {
+		l(operationType, id)
+	}
+	txn, ok := mongo.TxnFromContext(ctx)
+	if !ok {
+		return
+	}
+	for _, l := range s.listenersTxn[txn.SessionID] {
+		l(operationType, id)
+	}
 }
 
 // AddListenerCreate registers a callback to be called when an entity with the given ID is created.
@@ -108,6 +128,57 @@ func (s *Notifier[T]) AddListenerDelete(id string, c func()) string {
 	return ui
 }
 
+// AddListenerTxn registers a callback to be called for every event produced by a transaction of the session
+// (see mongo.SessionID), with the kind of the applied change (insert, update or delete) and the entity ID.
+// Returns a unique listener ID that can be used to remove the listener.
+func (s *Notifier[T]) AddListenerTxn(sessionID string, c func(operationType, id string)) string {
+	s.Lock()
+	defer s.Unlock()
+	ui := uuid.NewString()
+	if s.listenersTxn == nil {
+		s.listenersTxn = map[string]map[string]func(operationType, id string){}
+	}
+	if _, ok := s.listenersTxn[sessionID]; !ok {
+		s.listenersTxn[sessionID] = map[string]func(operationType, id string){}
+	}
+	s.listenersTxn[sessionID][ui] = c
+	return ui
+}
+
+// DeleteListenerTxn removes a transaction listener by its unique ID.
+func (s *Notifier[T]) DeleteListenerTxn(sessionID, ui string) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.listenersTxn[sessionID]; !ok {
+		return
+	}
+	delete(s.listenersTxn[sessionID], ui)
+	if len(s.listenersTxn[sessionID]) == 0 {
+		delete(s.listenersTxn, sessionID)
+	}
+}
+
+// AddListenerBatch registers a callback to be called for every event, with the kind of the applied change
+// (insert, update or delete) and the entity ID. It is used to wait for a batch of changes with a single listener.
+// Returns a unique listener ID that can be used to remove the listener.
+func (s *Notifier[T]) AddListenerBatch(c func(operationType, id string)) string {
+	s.Lock()
+	defer s.Unlock()
+	ui := uuid.NewString()
+	if s.listenersBatch == nil {
+		s.listenersBatch = map[string]func(operationType, id string){}
+	}
+	s.listenersBatch[ui] = c
+	return ui
+}
+
+// DeleteListenerBatch removes a batch listener by its unique ID.
+func (s *Notifier[T]) DeleteListenerBatch(ui string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.listenersBatch, ui)
+}
+
 // DeleteListenerCreate removes a create listener by its unique ID.
 func (s *Notifier[T]) DeleteListenerCreate(id, ui string) {
 	s.Lock()
@@ -138,6 +209,64 @@ func (s *Notifier[T]) DeleteListenerDelete(id, ui string) {
 	delete(s.listenersDelete[id], ui)
 }
 
+// eventWaiter counts the change events expected from a transaction or a batch of writes
+// and closes done once they all have been applied.
+type eventWaiter struct {
+	sync.Mutex
+	pending map[string]int
+	armed   bool
+	done    chan struct{}
+}
+
+func newEventWaiter() *eventWaiter {
+	return &eventWaiter{
+		pending: map[string]int{},
+		done:    make(chan struct{}),
+	}
+}
+
+func (w *eventWaiter) expect(operationType, id string) {
+	w.Lock()
+	defer w.Unlock()
+	w.pending[operationType+":"+id]++
+}
+
+// resolve marks an expected event as applied. Events which are not expected are ignored.
+func (w *eventWaiter) resolve(operationType, id string) {
+	w.forget(operationType, id)
+}
+
+func (w *eventWaiter) forget(operationType, id string) {
+	w.Lock()
+	defer w.Unlock()
+	key := operationType + ":" + id
+	if w.pending[key] == 0 {
+		return
+	}
+	if w.pending[key]--; w.pending[key] == 0 {
+		delete(w.pending, key)
+	}
+	w.check()
+}
+
+// ready allows done to be closed: expectations of operations which changed nothing are forgotten by then.
+func (w *eventWaiter) ready() {
+	w.Lock()
+	defer w.Unlock()
+	w.armed = true
+	w.check()
+}
+
+func (w *eventWaiter) check() {
+	if w.armed && len(w.pending) == 0 {
+		select {
+		case <-w.done:
+		default:
+			close(w.done)
+		}
+	}
+}
+
 // NewNotifier creates a new Notifier instance for waiting on cache updates.
 // The maps are used to store listeners organized by entity ID and listener ID.
 func NewNotifier[T d](
@@ -0,0 +1,121 @@
+package inmemory
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Query events of a subscription (see Listener.Subscribe).
+const (
+	// Entered is sent when an entity starts matching the query: it is inserted or changed to match.
+	Entered = "entered"
+	// Left is sent when an entity stops matching the query: it is deleted or changed not to match.
+	Left = "left"
+	// Changed is sent when an entity which matches the query is changed and still matches it.
+	Changed = "changed"
+)
+
+// QueryEvent is an event of a query subscription. Before is the zero value for Entered
+// and After is the zero value for Left.
+type QueryEvent[T d] struct {
+	Type   string
+	ID     string
+	Before T
+	After  T
+}
+
+// FieldEquals returns a query matching the entities whose value at the dotted bson path equals value
+// (pointers are dereferenced, see OnFieldChange), e.g. FieldEquals[*Ticket]("team", "x").
+func FieldEquals[T d](path string, value any) func(v T) bool {
+	return func(v T) bool {
+		fv, found := fieldValue(v, path)
+		return found && reflect.DeepEqual(fv, value)
+	}
+}
+
+// querySubscription is a live result set: the IDs of the matching entities.
+type querySubscription[T d] struct {
+	mu       sync.Mutex
+	match    func(v T) bool
+	callback func(ctx context.Context, event QueryEvent[T])
+	members  map[string]struct{}
+}
+
+func (s *querySubscription[T]) change(ctx context.Context, change Change[T]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, member := s.members[change.ID]
+	matches := change.HasAfter && s.match(change.After)
+	event := QueryEvent[T]{ID: change.ID}
+	switch {
+	case matches && !member:
+		s.members[change.ID] = struct{}{}
+		event.Type, event.After = Entered, change.After
+	case !matches && member:
+		delete(s.members, change.ID)
+		event.Type, event.Before = Left, change.Before
+	case matches && member:
+		event.Type, event.Before, event.After = Changed, change.Before, change.After
+	default:
+		return
+	}
+	s.callback(ctx, event)
+}
+
+// querySubscriptions dispatches the changes of a projection to its query subscriptions.
+type querySubscriptions[T d] struct {
+	mu   sync.RWMutex
+	subs map[string]*querySubscription[T]
+}
+
+func (q *querySubscriptions[T]) empty() bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.subs) == 0
+}
+
+func (q *querySubscriptions[T]) dispatch(ctx context.Context, change Change[T]) {
+	q.mu.RLock()
+	subs := make([]*querySubscription[T], 0, len(q.subs))
+	for _, s := range q.subs {
+		subs = append(subs, s)
+	}
+	q.mu.RUnlock()
+	for _, s := range subs {
+		s.change(ctx, change)
+	}
+}
+
+// Subscribe subscribes to a live query: the entities of the projection matching the predicate
+// (see FieldEquals for a query on a field). It returns the snapshot of the matching entities and then
+// calls the callback with an Entered, Left or Changed event whenever the result set or one of its
+// entities changes, after the cache is changed. Events of a subscription are sent one at a time;
+// the callback must not subscribe or unsubscribe. It returns a function which unsubscribes.
+func (c *Listener[T]) Subscribe(ctx context.Context, match func(v T) bool, callback func(ctx context.Context, event QueryEvent[T])) (snapshot []T, unsubscribe func()) {
+	s := &querySubscription[T]{match: match, callback: callback, members: map[string]struct{}{}}
+	// The subscription is registered before the snapshot is taken, and holds its lock while it is taken:
+	// a change applied meanwhile is sent after the snapshot, and only if it changes the result set.
+	s.mu.Lock()
+	ui := uuid.NewString()
+	c.queries.mu.Lock()
+	if c.queries.subs == nil {
+		c.queries.subs = map[string]*querySubscription[T]{}
+	}
+	c.queries.subs[ui] = s
+	c.queries.mu.Unlock()
+	for _, id := range c.cache.All(ctx) {
+		if it, found := c.cache.Get(ctx, id); found && match(it) {
+			s.members[id] = struct{}{}
+			snapshot = append(snapshot, it)
+		}
+	}
+	s.mu.Unlock()
+	return snapshot, func() {
+		c.queries.mu.Lock()
+		defer c.queries.mu.Unlock()
+		delete(c.queries.subs, ui)
+	}
+}
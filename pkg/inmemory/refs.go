@@ -0,0 +1,193 @@
+package inmemory
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Refs is a registry of projections which enforces the references between them (see mongo.RefField):
+// the Processor of a registered projection checks that the referenced documents exist in the caches
+// of the referenced projections, and a delete of a referenced document applies the on-delete policies
+// through the InMemory of the referencing projections. Projections are registered by Entity.Refs.
+// References to collections which are not registered are not checked.
+type Refs struct {
+	mu          sync.RWMutex
+	projections map[string]refProjection
+	edges       map[string][]refEdge // referenced collection -> references to it
+}
+
+// refEdge is a reference of a registered projection to another collection.
+type refEdge struct {
+	collection string
+	field      mongo.RefField
+}
+
+// refProjection is implemented by inMemory.
+type refProjection interface {
+	exists(ctx context.Context, id string) bool
+	referencing(ctx context.Context, field mongo.RefField, id string, excludeDeleted bool) (ids []string, err error)
+	deleteRef(ctx context.Context, id string) (err error)
+	clearRef(ctx context.Context, id string, field mongo.RefField, ref string) (err error)
+}
+
+// NewRefs creates an empty registry.
+func NewRefs() *Refs {
+	return &Refs{
+		projections: map[string]refProjection{},
+		edges:       map[string][]refEdge{},
+	}
+}
+
+func (r *Refs) register(collection string, p refProjection, fields []mongo.RefField) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.projections[collection] = p
+	for _, f := range fields {
+		if f.OnDelete == "" {
+			continue
+		}
+		r.edges[f.Collection] = append(r.edges[f.Collection], refEdge{collection: collection, field: f})
+	}
+}
+
+// Exists reports whether the document with the ID is in the cache of the projection of the collection.
+func (r *Refs) Exists(ctx context.Context, collection, id string) bool {
+	r.mu.RLock()
+	p, ok := r.projections[collection]
+	r.mu.RUnlock()
+	return !ok || p.exists(ctx, id)
+}
+
+// CheckDelete returns a mongo.ReferenceError if the document of the collection is referenced
+// with the restrict on-delete policy (soft-deleted referencing documents do not count). It does not write.
+func (r *Refs) CheckDelete(ctx context.Context, collection, id string) (err error) {
+	edges, projections := r.referencedBy(collection)
+	for _, e := range edges {
+		if e.field.OnDelete != mongo.OnDeleteRestrict {
+			continue
+		}
+		ids, err := projections[e.collection].referencing(ctx, e.field, id, true)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			return &mongo.ReferenceError{Field: e.collection + "." + e.field.Field, Collection: collection, ID: id, Referenced: true}
+		}
+	}
+	return
+}
+
+// OnDelete applies the on-delete policies of the references to the deleted document of the collection:
+// cascade deletes the referencing documents and setnull clears their references. It is called once
+// the document is deleted, as a restricted delete is rejected by CheckDelete before. Cascades and cleared
+// references of cached documents are awaited, so it must not run inside a transaction which is not committed.
+func (r *Refs) OnDelete(ctx context.Context, collection, id string) (err error) {
+	edges, projections := r.referencedBy(collection)
+	for _, e := range edges {
+		if e.field.OnDelete == mongo.OnDeleteRestrict {
+			continue
+		}
+		p := projections[e.collection]
+		ids, err := p.referencing(ctx, e.field, id, false)
+		if err != nil {
+			return err
+		}
+		for _, ref := range ids {
+			if e.field.OnDelete == mongo.OnDeleteCascade {
+				err = p.deleteRef(ctx, ref)
+			} else {
+				err = p.clearRef(ctx, ref, e.field, id)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
+
+// referencedBy returns the references to the collection and the projections they belong to.
+func (r *Refs) referencedBy(collection string) (edges []refEdge, projections map[string]refProjection) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	edges = r.edges[collection]
+	projections = make(map[string]refProjection, len(edges))
+	for _, e := range edges {
+		projections[e.collection] = r.projections[e.collection]
+	}
+	return
+}
+
+func (p *inMemory[T]) exists(ctx context.Context, id string) bool {
+	_, found := p.CacheWithEventListener.Cache.GetIndexByID(id)
+	return found
+}
+
+// referencing returns the IDs of the documents referencing id by the field, without the soft-deleted ones
+// if excludeDeleted is set and the projection is in the soft-delete mode.
+func (p *inMemory[T]) referencing(ctx context.Context, field mongo.RefField, id string, excludeDeleted bool) (ids []string, err error) {
+	filter := field.Filter(id)
+	if excludeDeleted && p.soft != nil {
+		filter = notDeleted(filter)
+	}
+	its, err := p.Mongo.Searcher.FindWithFilter(ctx, filter)
+	if err != nil {
+		return
+	}
+	for _, it := range its {
+		ids = append(ids, it.ID())
+	}
+	return
+}
+
+// deleteRef deletes a referencing document. A document which is not cached (e.g. filtered out of the projection)
+// is deleted without waiting for its event; one which is soft-deleted already is left as it is.
+func (p *inMemory[T]) deleteRef(ctx context.Context, id string) (err error) {
+	if it, found := p.CacheWithEventListener.Cache.Get(ctx, id); found {
+		return p.AwaitDelete(ctx, it)
+	}
+	if p.soft == nil {
+		return p.Mongo.Processor.Delete(ctx, id)
+	}
+	if p.soft.isSoftDeleted(id) {
+		return
+	}
+	if err = p.Mongo.Processor.PrepareDelete(ctx, id); err != nil {
+		return
+	}
+	found, err := p.Mongo.Updater.UpdateOneIf(ctx, id, nil,
+		bson.D{{Key: "deleted", Value: bson.M{"$ne": true}}}, bson.D{{Key: "deleted", Value: true}}, nil)
+	if err != nil || !found {
+		return
+	}
+	return p.Mongo.Processor.CompleteDelete(ctx, id)
+}
+
+func (p *inMemory[T]) clearRef(ctx context.Context, id string, field mongo.RefField, ref string) (err error) {
+	u := mongo.NewUpdate()
+	if field.Many {
+		u.Pull(field.Field, field.Filter(ref)[field.Field])
+	} else {
+		u.Set(field.Field, nil)
+	}
+	_, err = p.AwaitUpdateOps(ctx, id, u)
+	return
+}
+
+// registerRefs registers the projection in the registry of Entity.Refs with the references of T.
+func (p *inMemory[T]) registerRefs(refs *Refs, collection string) (err error) {
+	var v T
+	fields, err := mongo.RefFields(reflect.TypeOf(v))
+	if err != nil {
+		return
+	}
+	refs.register(collection, p, fields)
+	if pr, ok := p.Mongo.Processor.(*mongo.Processor[T]); ok {
+		pr.SetReferences(collection, refs)
+	}
+	return
+}
@@ -0,0 +1,76 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+// fakeRefProjection references documents of other collections by the IDs in refs.
+type fakeRefProjection struct {
+	ids     map[string]bool
+	refs    map[string]string // id -> referenced id
+	removed map[string]bool   // soft-deleted ids
+	deleted []string
+	cleared []string
+}
+
+func (p *fakeRefProjection) exists(ctx context.Context, id string) bool {
+	return p.ids[id]
+}
+
+func (p *fakeRefProjection) referencing(ctx context.Context, field mongo.RefField, id string, excludeDeleted bool) (ids []string, err error) {
+	for it, ref := range p.refs {
+		if ref == id && !(excludeDeleted && p.removed[it]) {
+			ids = append(ids, it)
+		}
+	}
+	return
+}
+
+func (p *fakeRefProjection) deleteRef(ctx context.Context, id string) error {
+	p.deleted = append(p.deleted, id)
+	return nil
+}
+
+func (p *fakeRefProjection) clearRef(ctx context.Context, id string, field mongo.RefField, ref string) error {
+	p.cleared = append(p.cleared, id)
+	return nil
+}
+
+func TestRefs(t *testing.T) {
+	ctx := context.Background()
+	r := NewRefs()
+	categories := &fakeRefProjection{ids: map[string]bool{"c1": true, "c2": true, "c3": true}}
+	posts := &fakeRefProjection{refs: map[string]string{"p1": "c1"}}
+	comments := &fakeRefProjection{refs: map[string]string{"m1": "c1", "m2": "c2"}}
+	orders := &fakeRefProjection{refs: map[string]string{"o1": "c2", "o2": "c3"}, removed: map[string]bool{"o2": true}}
+	r.register("categories", categories, nil)
+	r.register("posts", posts, []mongo.RefField{{Field: "category", Collection: "categories", OnDelete: mongo.OnDeleteCascade}})
+	r.register("comments", comments, []mongo.RefField{{Field: "category", Collection: "categories", OnDelete: mongo.OnDeleteSetNull}})
+	r.register("orders", orders, []mongo.RefField{{Field: "category", Collection: "categories", OnDelete: mongo.OnDeleteRestrict}})
+
+	assert.True(t, r.Exists(ctx, "categories", "c1"))
+	assert.False(t, r.Exists(ctx, "categories", "c4"))
+	// not registered: not checked
+	assert.True(t, r.Exists(ctx, "users", "u1"))
+
+	assert.NoError(t, r.CheckDelete(ctx, "categories", "c1"))
+	assert.Empty(t, posts.deleted)
+	assert.NoError(t, r.OnDelete(ctx, "categories", "c1"))
+	assert.Equal(t, []string{"p1"}, posts.deleted)
+	assert.Equal(t, []string{"m1"}, comments.cleared)
+
+	// restricted: rejected by the check, which does not write
+	err := r.CheckDelete(ctx, "categories", "c2")
+	var refErr *mongo.ReferenceError
+	assert.ErrorAs(t, err, &refErr)
+	assert.True(t, refErr.Referenced)
+	assert.Equal(t, []string{"m1"}, comments.cleared)
+
+	// soft-deleted referencing documents do not restrict
+	assert.NoError(t, r.CheckDelete(ctx, "categories", "c3"))
+}
@@ -0,0 +1,396 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// softDeleteHandler implements the soft-delete mode of a projection (see Entity.SoftDelete).
+// It is the head of the handler chain, in front of a filteredHandler which keeps only documents
+// that are not deleted in the cache and indexes. Soft-deleted documents are kept in a separate cache,
+// so they can still be read explicitly and restored without a lookup.
+type softDeleteHandler[T d] struct {
+	next    syncHandler[T]
+	cache   Cache[T]
+	deleted Cache[T]
+	notify  Notify[T]
+}
+
+func newSoftDeleteHandler[T d](next syncHandler[T], cache Cache[T], notify Notify[T]) *softDeleteHandler[T] {
+	return &softDeleteHandler[T]{
+		next:    next,
+		cache:   cache,
+		deleted: NewCache[T](map[string]T{}),
+		notify:  notify,
+	}
+}
+
+func (s *softDeleteHandler[T]) isSoftDeleted(id string) bool {
+	_, found := s.deleted.GetIndexByID(id)
+	return found
+}
+
+// keep stores a soft-deleted document in the deleted cache or removes a document which is not deleted from it.
+func (s *softDeleteHandler[T]) keep(ctx context.Context, v T) {
+	if isDeleted(v) {
+		s.deleted.Add(ctx, v)
+		return
+	}
+	if s.isSoftDeleted(v.ID()) {
+		_id, err := primitive.ObjectIDFromHex(v.ID())
+		if err == nil {
+			s.deleted.Delete(ctx, _id)
+		}
+	}
+}
+
+// Add ...
+func (s *softDeleteHandler[T]) Add(ctx context.Context, v T) {
+	s.keep(ctx, v)
+	s.next.Add(ctx, v)
+}
+
+// Replace ...
+func (s *softDeleteHandler[T]) Replace(ctx context.Context, v T) {
+	s.keep(ctx, v)
+	s.next.Replace(ctx, v)
+}
+
+// ReplaceWithPreImage ...
+func (s *softDeleteHandler[T]) ReplaceWithPreImage(ctx context.Context, before, v T) {
+	s.keep(ctx, v)
+	if r, ok := s.next.(interface {
+		ReplaceWithPreImage(ctx context.Context, before, v T)
+	}); ok {
+		r.ReplaceWithPreImage(ctx, before, v)
+		return
+	}
+	s.next.Replace(ctx, v)
+}
+
+// Update ...
+func (s *softDeleteHandler[T]) Update(ctx context.Context, _id primitive.ObjectID, updatedFields T, removedFields []string) {
+	s.UpdateFields(ctx, _id, updatedFields, nil, removedFields)
+}
+
+// UpdateFields applies the update to the deleted cache as well: a cached document which becomes deleted
+// is moved there (the filter evicts it from the projection), a soft-deleted document which is restored
+// is added back to the projection as a whole.
+func (s *softDeleteHandler[T]) UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string) {
+	s.updateFields(ctx, _id, nil, updatedFields, fields, removedFields)
+}
+
+// UpdateFieldsWithPreImage ...
+func (s *softDeleteHandler[T]) UpdateFieldsWithPreImage(ctx context.Context, _id primitive.ObjectID, before, updatedFields T, fields []string, removedFields []string) {
+	s.updateFields(ctx, _id, &before, updatedFields, fields, removedFields)
+}
+
+func (s *softDeleteHandler[T]) updateFields(ctx context.Context, _id primitive.ObjectID, pre *T, updatedFields T, fields []string, removedFields []string) {
+	id := _id.Hex()
+	if s.isSoftDeleted(id) {
+		s.deleted.UpdateFields(ctx, _id, updatedFields, fields, removedFields)
+		it, found := s.deleted.Get(ctx, id)
+		if found && !isDeleted(it) {
+			s.deleted.Delete(ctx, _id)
+			s.next.Add(ctx, it)
+			return
+		}
+		s.notify.Update(ctx, _id, updatedFields, removedFields)
+		return
+	}
+	if it, found := s.cache.Get(ctx, id); found {
+		// Apply the update to a copy to find out whether the document becomes deleted.
+		scratch := NewCache[T](map[string]T{id: it})
+		scratch.UpdateFields(ctx, _id, updatedFields, fields, removedFields)
+		if it, _ = scratch.Get(ctx, id); isDeleted(it) {
+			s.deleted.Add(ctx, it)
+		}
+	}
+	s.forward(ctx, _id, pre, updatedFields, fields, removedFields)
+}
+
+func (s *softDeleteHandler[T]) forward(ctx context.Context, _id primitive.ObjectID, pre *T, updatedFields T, fields []string, removedFields []string) {
+	if u, ok := s.next.(interface {
+		UpdateFieldsWithPreImage(ctx context.Context, _id primitive.ObjectID, before, updatedFields T, fields []string, removedFields []string)
+	}); ok && pre != nil {
+		u.UpdateFieldsWithPreImage(ctx, _id, *pre, updatedFields, fields, removedFields)
+		return
+	}
+	if u, ok := s.next.(interface {
+		UpdateFields(ctx context.Context, _id primitive.ObjectID, updatedFields T, fields []string, removedFields []string)
+	}); ok && fields != nil {
+		u.UpdateFields(ctx, _id, updatedFields, fields, removedFields)
+		return
+	}
+	s.next.Update(ctx, _id, updatedFields, removedFields)
+}
+
+// Patch applies nested paths to cached documents only; a document which becomes deleted is moved to the deleted cache.
+func (s *softDeleteHandler[T]) Patch(ctx context.Context, _id primitive.ObjectID, patch *mongo.Patch) (applied bool) {
+	p, ok := s.next.(interface {
+		Patch(ctx context.Context, _id primitive.ObjectID, patch *mongo.Patch) (applied bool)
+	})
+	if !ok || s.isSoftDeleted(_id.Hex()) {
+		return
+	}
+	it, found := s.cache.Get(ctx, _id.Hex())
+	if !found {
+		return
+	}
+	patched, err := mongo.ApplyPatch(it, patch)
+	if err != nil {
+		return
+	}
+	if !p.Patch(ctx, _id, patch) {
+		return
+	}
+	if isDeleted(patched) {
+		s.deleted.Add(ctx, patched)
+	}
+	return true
+}
+
+// PatchWithPreImage applies nested paths to the pre-image of a cached document like Patch.
+func (s *softDeleteHandler[T]) PatchWithPreImage(ctx context.Context, _id primitive.ObjectID, before T, patch *mongo.Patch) (applied bool) {
+	p, ok := s.next.(interface {
+		PatchWithPreImage(ctx context.Context, _id primitive.ObjectID, before T, patch *mongo.Patch) (applied bool)
+	})
+	if !ok || s.isSoftDeleted(_id.Hex()) {
+		return
+	}
+	if _, found := s.cache.Get(ctx, _id.Hex()); !found {
+		return
+	}
+	patched, err := mongo.ApplyPatch(before, patch)
+	if err != nil {
+		return
+	}
+	if !p.PatchWithPreImage(ctx, _id, before, patch) {
+		return
+	}
+	if isDeleted(patched) {
+		s.deleted.Add(ctx, patched)
+	}
+	return true
+}
+
+// Delete removes a document from the projection and from the deleted cache (a hard delete, e.g. Purge).
+func (s *softDeleteHandler[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
+	s.deleted.Delete(ctx, _id)
+	s.next.Delete(ctx, _id)
+}
+
+// DeleteWithPreImage ...
+func (s *softDeleteHandler[T]) DeleteWithPreImage(ctx context.Context, _id primitive.ObjectID, before T) {
+	s.deleted.Delete(ctx, _id)
+	if r, ok := s.next.(interface {
+		DeleteWithPreImage(ctx context.Context, _id primitive.ObjectID, before T)
+	}); ok {
+		r.DeleteWithPreImage(ctx, _id, before)
+		return
+	}
+	s.next.Delete(ctx, _id)
+}
+
+// Clear ...
+func (s *softDeleteHandler[T]) Clear(ctx context.Context) {
+	for _, id := range s.deleted.All(ctx) {
+		if _id, err := primitive.ObjectIDFromHex(id); err == nil {
+			s.deleted.Delete(ctx, _id)
+		}
+	}
+	if c, ok := s.next.(interface{ Clear(ctx context.Context) }); ok {
+		c.Clear(ctx)
+	}
+}
+
+// isDeleted reports whether an entity is soft-deleted: by its IsDeleted method if it has one,
+// otherwise by its bool or *bool field with the bson name "deleted" (untagged struct fields are inlined).
+func isDeleted(v any) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return false
+	}
+	if dv, ok := v.(interface{ IsDeleted() bool }); ok {
+		return dv.IsDeleted()
+	}
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return false
+		}
+		rv = rv.Elem()
+	}
+	return deletedField(rv)
+}
+
+func deletedField(rv reflect.Value) bool {
+	if rv.Kind() != reflect.Struct {
+		return false
+	}
+	rt := rv.Type()
+	for i := 0; i < rv.NumField(); i++ {
+		key := bsonKey(rt.Field(i))
+		f := rv.Field(i)
+		if key == "" && f.Kind() == reflect.Struct {
+			if deletedField(f) {
+				return true
+			}
+			continue
+		}
+		if key != "deleted" {
+			continue
+		}
+		if f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				return false
+			}
+			f = f.Elem()
+		}
+		return f.Kind() == reflect.Bool && f.Bool()
+	}
+	return false
+}
+
+// errNotSoftDelete is returned by the soft-delete operations of a projection without Entity.SoftDelete.
+var errNotSoftDelete = errors.New("soft-delete mode is not enabled")
+
+// softDelete sets deleted=true with a version bump and waits until the entity leaves the cache.
+// Deleting an entity which is already soft-deleted is a no-op.
+func (p *inMemory[T]) softDelete(ctx context.Context, id string) (err error) {
+	if p.soft.isSoftDeleted(id) {
+		return
+	}
+	if _, found := p.CacheWithEventListener.Cache.Get(ctx, id); !found {
+		return mongo.ErrNotFound
+	}
+	if err = p.Mongo.Processor.PrepareDelete(ctx, id); err != nil {
+		return
+	}
+	found, err := p.await(ctx, id, p.CacheWithEventListener.AwaitNotify.AddListenerDelete, p.CacheWithEventListener.AwaitNotify.DeleteListenerDelete, func() (bool, error) {
+		return p.Mongo.Updater.UpdateOne(ctx, id, nil, bson.D{{Key: "deleted", Value: true}}, nil)
+	})
+	if err != nil {
+		return
+	}
+	if !found {
+		return mongo.ErrNotFound
+	}
+	return p.Mongo.Processor.CompleteDelete(ctx, id)
+}
+
+// softDeleteMany marks the entities deleted with a single write, checking all of them before it and
+// applying the on-delete policies of the references after it, as mongo.Processor.DeleteMany does.
+// errs has an element per ID: nil if it was marked deleted, otherwise its error.
+func (p *inMemory[T]) softDeleteMany(ctx context.Context, ids []string) (errs []error, err error) {
+	errs = make([]error, len(ids))
+	_ids := make(bson.A, 0, len(ids))
+	var items []int
+	for i, id := range ids {
+		_id, e := primitive.ObjectIDFromHex(id)
+		if e != nil {
+			errs[i] = e
+			continue
+		}
+		if _, found := p.CacheWithEventListener.Cache.Get(ctx, id); !found {
+			errs[i] = mongo.ErrNotFound
+			continue
+		}
+		if e = p.Mongo.Processor.PrepareDelete(ctx, id); e != nil {
+			errs[i] = e
+			continue
+		}
+		_ids = append(_ids, _id)
+		items = append(items, i)
+	}
+	if len(_ids) == 0 {
+		return
+	}
+	// Documents deleted concurrently are not matched, their delete events are awaited all the same.
+	_, err = p.Mongo.Updater.UpdateMany(ctx, notDeleted(bson.M{"_id": bson.M{"$in": _ids}}), bson.D{{Key: "deleted", Value: true}})
+	if err != nil {
+		return
+	}
+	for _, i := range items {
+		errs[i] = p.Mongo.Processor.CompleteDelete(ctx, ids[i])
+	}
+	return
+}
+
+// notDeleted restricts the filter to the documents which are not soft-deleted.
+func notDeleted(filter bson.M) bson.M {
+	return bson.M{"$and": bson.A{filter, bson.M{"deleted": bson.M{"$ne": true}}}}
+}
+
+// GetIncludeDeleted returns an entity by its ID, including a soft-deleted one.
+func (p *inMemory[T]) GetIncludeDeleted(ctx context.Context, id string) (it T, found bool) {
+	if p.CacheWithEventListener == nil {
+		return
+	}
+	if it, found = p.CacheWithEventListener.Cache.Get(ctx, id); found || p.soft == nil {
+		return
+	}
+	return p.soft.deleted.Get(ctx, id)
+}
+
+// AllIncludeDeleted returns the IDs of all the entities, including the soft-deleted ones.
+func (p *inMemory[T]) AllIncludeDeleted(ctx context.Context) (ids []string) {
+	if p.CacheWithEventListener == nil {
+		return
+	}
+	ids = p.CacheWithEventListener.Cache.All(ctx)
+	if p.soft != nil {
+		ids = append(ids, p.soft.deleted.All(ctx)...)
+	}
+	return
+}
+
+// Restore undeletes a soft-deleted entity and waits until it is back in the cache.
+// It returns mongo.ErrNotFound if the entity is not soft-deleted.
+func (p *inMemory[T]) Restore(ctx context.Context, id string) (err error) {
+	if p.CacheWithEventListener == nil || p.soft == nil {
+		return errNotSoftDelete
+	}
+	if !p.soft.isSoftDeleted(id) {
+		return mongo.ErrNotFound
+	}
+	found, err := p.await(ctx, id, p.CacheWithEventListener.AwaitNotify.AddListenerCreate, p.CacheWithEventListener.AwaitNotify.DeleteListenerCreate, func() (bool, error) {
+		return p.Mongo.Updater.UpdateOne(ctx, id, nil, bson.D{{Key: "deleted", Value: false}}, nil)
+	})
+	if err == nil && !found {
+		err = mongo.ErrNotFound
+	}
+	return
+}
+
+// Purge removes an entity, soft-deleted or not, from MongoDB and waits until it is removed from the projection.
+func (p *inMemory[T]) Purge(ctx context.Context, id string) (err error) {
+	if p.CacheWithEventListener == nil || p.soft == nil {
+		return errNotSoftDelete
+	}
+	if _, found := p.GetIncludeDeleted(ctx, id); !found {
+		return mongo.ErrNotFound
+	}
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+	if err = p.Mongo.Processor.PrepareDelete(ctx, id); err != nil {
+		return
+	}
+	found, err := p.await(ctx, id, p.CacheWithEventListener.AwaitNotify.AddListenerDelete, p.CacheWithEventListener.AwaitNotify.DeleteListenerDelete, func() (bool, error) {
+		n, err := p.Mongo.Remover.Remove(ctx, bson.D{{Key: "_id", Value: _id}})
+		return n == 1, err
+	})
+	if err != nil {
+		return
+	}
+	if !found {
+		return mongo.ErrNotFound
+	}
+	return p.Mongo.Processor.CompleteDelete(ctx, id)
+}
@@ -0,0 +1,64 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftDeleteHandler(t *testing.T) {
+	ctx := context.Background()
+	orig := "orig"
+	yes, no := true, false
+	c := NewCacheWithEventListener[*Image](nil, nil, nil)
+	f := newFilteredHandler[*Image](c.EventListener, c.Cache, c.AwaitNotify, func(v *Image) bool {
+		return !isDeleted(v)
+	})
+	h := newSoftDeleteHandler[*Image](f, c.Cache, c.AwaitNotify)
+
+	it := &Image{Orig: &orig}
+	h.Add(ctx, it)
+	_, found := c.Cache.Get(ctx, it.ID())
+	assert.True(t, found)
+	assert.Equal(t, []string{it.ID()}, c.InverseIndexes["orig"].Get(ctx, &orig))
+
+	// soft-deleted: evicted from the cache and indexes, kept in the deleted cache
+	notified := false
+	c.AwaitNotify.AddListenerDelete(it.ID(), func() { notified = true })
+	h.Update(ctx, it.Id, &Image{D: D{Deleted: &yes}}, nil)
+	assert.True(t, notified)
+	_, found = c.Cache.Get(ctx, it.ID())
+	assert.False(t, found)
+	assert.Empty(t, c.InverseIndexes["orig"].Get(ctx, &orig))
+	deleted, found := h.deleted.Get(ctx, it.ID())
+	assert.True(t, found)
+	assert.Equal(t, orig, *deleted.Orig)
+
+	// restored: added back as a whole
+	notified = false
+	c.AwaitNotify.AddListenerCreate(it.ID(), func() { notified = true })
+	h.Update(ctx, it.Id, &Image{D: D{Deleted: &no}}, nil)
+	assert.True(t, notified)
+	restored, found := c.Cache.Get(ctx, it.ID())
+	assert.True(t, found)
+	assert.Equal(t, orig, *restored.Orig)
+	assert.Equal(t, []string{it.ID()}, c.InverseIndexes["orig"].Get(ctx, &orig))
+	assert.False(t, h.isSoftDeleted(it.ID()))
+
+	// purged while soft-deleted: removed from both caches
+	h.Update(ctx, it.Id, &Image{D: D{Deleted: &yes}}, nil)
+	assert.True(t, h.isSoftDeleted(it.ID()))
+	h.Delete(ctx, it.Id)
+	assert.False(t, h.isSoftDeleted(it.ID()))
+	_, found = c.Cache.Get(ctx, it.ID())
+	assert.False(t, found)
+}
+
+func TestIsDeleted(t *testing.T) {
+	yes, no := true, false
+	assert.False(t, isDeleted(&Image{}))
+	assert.False(t, isDeleted(&Image{D: D{Deleted: &no}}))
+	assert.True(t, isDeleted(&Image{D: D{Deleted: &yes}}))
+	assert.False(t, isDeleted((*Image)(nil)))
+}
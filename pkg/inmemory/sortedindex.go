@@ -57,7 +57,7 @@ func (s *sortedIndex[T]) Update(ctx context.Context, id primitive.ObjectID, upda
 	s.Lock()
 	defer s.Unlock()
 	updatedVal := updateStringFieldValuesByName(updatedFields, s.from)
-	if updatedVal == nil {
+	if updatedVal == nil && !isFieldRemoved(updatedFields, s.from, removedFields) {
 		return
 	}
 	if it, found := s.cache.Get(ctx, id.Hex()); found {
@@ -72,10 +72,20 @@ func (s *sortedIndex[T]) Update(ctx context.Context, id primitive.ObjectID, upda
 				to = *_to
 			}
 		}
+		if updatedVal == nil {
+			s.sorted.Delete(ctx, to, *_from)
+			return
+		}
 		s.sorted.Update(ctx, to, *_from, *updatedVal)
 	}
 }
 
+// UpdateFields updates the index like Update; a key field present in the event with a zero or null value
+// removes the entity from the index.
+func (s *sortedIndex[T]) UpdateFields(ctx context.Context, id primitive.ObjectID, updatedFields T, fields []string, removedFields []string) {
+	s.Update(ctx, id, updatedFields, presentAsRemoved(fields, removedFields))
+}
+
 // Delete ...
 func (s *sortedIndex[T]) Delete(ctx context.Context, _id primitive.ObjectID) {
 	s.Lock()
@@ -0,0 +1,233 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mng "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TxOp is a write operation of a transaction, created by InMemory.CreateOp, UpdateOp and DeleteOp.
+type TxOp interface {
+	// exec runs the operation in the session context of the transaction.
+	// changed is false when the operation does not change the document (no event is expected).
+	exec(ctx context.Context) (changed bool, err error)
+	// expect returns the notifier of the projection and the change event expected from the operation.
+	expect() (notifier txnNotifier, operationType, id string)
+	// commit runs the writes which follow the operation once the transaction is committed
+	// (e.g. the on-delete policies of the references), outside of the transaction.
+	commit(ctx context.Context) (err error)
+}
+
+// txnNotifier is implemented by the await notifier of a projection (see Notifier.AddListenerTxn).
+type txnNotifier interface {
+	AddListenerTxn(sessionID string, c func(operationType, id string)) string
+	DeleteListenerTxn(sessionID, ui string)
+}
+
+// Tx runs write operations of one or more InMemory projections in a MongoDB transaction
+// and waits until all their changes are reflected in the in-memory caches.
+// Change events are matched to the transaction by the lsid of its session,
+// so concurrent writes of the same documents outside the transaction do not resolve the wait.
+// Transactions require a replica set or a sharded cluster.
+type Tx struct {
+	client *mng.Client
+	opts   *options.TransactionOptions
+}
+
+// NewTx creates a new Tx. opts are applied to every transaction run by it.
+func NewTx(client *mng.Client, opts ...*options.TransactionOptions) *Tx {
+	return &Tx{
+		client: client,
+		opts:   options.MergeTransactionOptions(opts...),
+	}
+}
+
+// Run executes the operations in order inside a session transaction (retried by the driver on transient errors)
+// and, once it is committed, applies the on-delete policies of the references to the deleted documents
+// (cascades and cleared references are not part of the transaction) and waits for the change events of all the operations.
+// After Run returns without error, subsequent reads from the caches see all the changes.
+// If ctx is done before all the events are applied, Run returns the context error; the transaction stays committed.
+func (t *Tx) Run(ctx context.Context, ops ...TxOp) (err error) {
+	if len(ops) == 0 {
+		return
+	}
+	session, err := t.client.StartSession()
+	if err != nil {
+		return
+	}
+	defer session.EndSession(ctx)
+	sessionID := mongo.SessionID(session.ID())
+	if sessionID == "" {
+		return errors.New("tx: unknown session id")
+	}
+	w := newEventWaiter()
+	notifiers := map[txnNotifier]struct{}{}
+	for _, op := range ops {
+		notifier, operationType, id := op.expect()
+		if notifier == nil {
+			return errors.New("cache is not initialized, Tx requires cache")
+		}
+		notifiers[notifier] = struct{}{}
+		w.expect(operationType, id)
+	}
+	for notifier := range notifiers {
+		ui := notifier.AddListenerTxn(sessionID, w.resolve)
+		defer notifier.DeleteListenerTxn(sessionID, ui)
+	}
+	changed := make([]bool, len(ops))
+	_, err = session.WithTransaction(ctx, func(sc mng.SessionContext) (interface{}, error) {
+		for i, op := range ops {
+			c, e := op.exec(sc)
+			if e != nil {
+				return nil, e
+			}
+			changed[i] = c
+		}
+		return nil, nil
+	}, t.opts)
+	if err != nil {
+		return
+	}
+	for i, op := range ops {
+		if !changed[i] {
+			_, operationType, id := op.expect()
+			w.forget(operationType, id)
+		}
+	}
+	for i, op := range ops {
+		if !changed[i] {
+			continue
+		}
+		if err = op.commit(ctx); err != nil {
+			return
+		}
+	}
+	w.ready()
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// txOp is a TxOp of an InMemory projection.
+type txOp struct {
+	notifier      txnNotifier
+	operationType string
+	id            string
+	run           func(ctx context.Context) (changed bool, err error)
+	after         func(ctx context.Context) (err error)
+}
+
+func (o *txOp) exec(ctx context.Context) (changed bool, err error) {
+	return o.run(ctx)
+}
+
+func (o *txOp) expect() (notifier txnNotifier, operationType, id string) {
+	return o.notifier, o.operationType, o.id
+}
+
+func (o *txOp) commit(ctx context.Context) (err error) {
+	if o.after == nil {
+		return
+	}
+	return o.after(ctx)
+}
+
+// CreateOp returns a transaction operation creating the entity (see Tx).
+func (p *inMemory[T]) CreateOp(ps T) TxOp {
+	return &txOp{
+		notifier:      p.txnNotifier(),
+		operationType: mongo.InsertOperationType,
+		id:            ps.ID(),
+		run: func(ctx context.Context) (changed bool, err error) {
+			_, err = p.Mongo.Processor.Create(ctx, ps)
+			return err == nil, err
+		},
+	}
+}
+
+// UpdateOp returns a transaction operation updating the entity (see Tx).
+// The transaction is aborted with mongo.ErrNotFound if the document does not exist or its version has advanced.
+func (p *inMemory[T]) UpdateOp(ps T) TxOp {
+	return &txOp{
+		notifier:      p.txnNotifier(),
+		operationType: mongo.UpdateOperationType,
+		id:            ps.ID(),
+		run: func(ctx context.Context) (changed bool, err error) {
+			prepared, set, unset, err := p.Mongo.Processor.PrepareUpdate(ctx, ps)
+			if err != nil {
+				return
+			}
+			if len(set) == 0 {
+				return
+			}
+			found, err := p.Mongo.Updater.UpdateOne(ctx, prepared.ID(), prepared.Version(), set, unset)
+			if err != nil {
+				return
+			}
+			if !found {
+				return false, mongo.ErrNotFound
+			}
+			return true, nil
+		},
+	}
+}
+
+// DeleteOp returns a transaction operation deleting the entity (see Tx).
+// In the soft-delete mode (see Entity.SoftDelete) the document is marked deleted instead of being removed.
+// The transaction is aborted with mongo.ErrNotFound if the document does not exist (or is soft-deleted already).
+// A restricted delete aborts it too; the cascade and setnull on-delete policies of the references to the document
+// are applied once the transaction is committed, as their writes are awaited in the caches.
+func (p *inMemory[T]) DeleteOp(ps T) TxOp {
+	return &txOp{
+		notifier:      p.txnNotifier(),
+		operationType: mongo.DeleteOperationType,
+		id:            ps.ID(),
+		run: func(ctx context.Context) (changed bool, err error) {
+			_id, err := primitive.ObjectIDFromHex(ps.ID())
+			if err != nil {
+				return
+			}
+			if err = p.Mongo.Processor.PrepareDelete(ctx, ps.ID()); err != nil {
+				return
+			}
+			if p.soft != nil {
+				found, err := p.Mongo.Updater.UpdateOneIf(ctx, ps.ID(), nil,
+					bson.D{{Key: "deleted", Value: bson.M{"$ne": true}}}, bson.D{{Key: "deleted", Value: true}}, nil)
+				if err != nil {
+					return false, err
+				}
+				if !found {
+					return false, mongo.ErrNotFound
+				}
+				return true, nil
+			}
+			deleted, err := p.Mongo.Remover.Remove(ctx, bson.D{{Key: "_id", Value: _id}})
+			if err != nil {
+				return
+			}
+			if deleted == 0 {
+				return false, mongo.ErrNotFound
+			}
+			return true, nil
+		},
+		after: func(ctx context.Context) (err error) {
+			return p.Mongo.Processor.CompleteDelete(ctx, ps.ID())
+		},
+	}
+}
+
+func (p *inMemory[T]) txnNotifier() txnNotifier {
+	if p.CacheWithEventListener == nil {
+		return nil
+	}
+	notifier, _ := p.CacheWithEventListener.AwaitNotify.(txnNotifier)
+	return notifier
+}
@@ -0,0 +1,132 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mng "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+func TestEventWaiter(t *testing.T) {
+	ctx := context.Background()
+	c := NewCacheWithEventListener[*Image](nil, nil, nil)
+	notifier := c.AwaitNotify.(txnNotifier)
+	created, updated := &Image{}, &Image{}
+	c.EventListener.Add(ctx, updated)
+
+	w := newEventWaiter()
+	w.expect(mongo.InsertOperationType, created.ID())
+	w.expect(mongo.UpdateOperationType, updated.ID())
+	w.expect(mongo.UpdateOperationType, created.ID())
+	ui := notifier.AddListenerTxn("session", w.resolve)
+	defer notifier.DeleteListenerTxn("session", ui)
+
+	txn := mongo.WithTxn(ctx, mongo.Txn{SessionID: "session", Number: 1})
+	other := mongo.WithTxn(ctx, mongo.Txn{SessionID: "other", Number: 1})
+	c.EventListener.Add(txn, created)
+	// events outside the transaction or of other sessions do not resolve the wait
+	c.EventListener.Update(ctx, updated.Id, updated, nil)
+	c.EventListener.Update(other, updated.Id, updated, nil)
+	c.EventListener.Update(txn, updated.Id, updated, nil)
+	w.forget(mongo.UpdateOperationType, created.ID())
+	select {
+	case <-w.done:
+		t.Fatal("done before ready")
+	default:
+	}
+	w.ready()
+	select {
+	case <-w.done:
+	default:
+		t.Fatal("not done")
+	}
+	assert.Empty(t, w.pending)
+}
+
+// txRemover removes documents by sending their delete events with the lsid of the session of the transaction,
+// as the Change Stream does once it is committed.
+type txRemover struct {
+	*mongo.Remover
+	c *CacheWithEventListener[*Image]
+}
+
+func (r *txRemover) Remove(ctx context.Context, doc interface{}) (deletedCount int, err error) {
+	session := mng.SessionFromContext(ctx)
+	txn := mongo.WithTxn(context.Background(), mongo.Txn{SessionID: mongo.SessionID(session.ID()), Number: 1})
+	go r.c.EventListener.Delete(txn, doc.(bson.D)[0].Value.(primitive.ObjectID))
+	return 1, nil
+}
+
+// cascadeProcessor deletes referencing documents and records whether it was called inside a transaction.
+type cascadeProcessor struct {
+	*mongo.Processor[*Image]
+	c       *CacheWithEventListener[*Image]
+	inTxn   bool
+	deleted []string
+}
+
+func (p *cascadeProcessor) Delete(ctx context.Context, id string) (err error) {
+	p.inTxn = p.inTxn || mng.SessionFromContext(ctx) != nil
+	p.deleted = append(p.deleted, id)
+	_id, _ := primitive.ObjectIDFromHex(id)
+	go p.c.EventListener.Delete(context.Background(), _id)
+	return
+}
+
+// refSearcher finds the referencing documents.
+type refSearcher struct {
+	*mongo.Searcher[*Image]
+	its []*Image
+}
+
+func (s *refSearcher) FindWithFilter(ctx context.Context, filter bson.M) (items []*Image, err error) {
+	return s.its, nil
+}
+
+func TestTx_DeleteCascade(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := mng.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:1"))
+	assert.NoError(t, err)
+	defer client.Disconnect(ctx)
+
+	cc := NewCacheWithEventListener[*Image](nil, nil, nil)
+	category := &Image{}
+	cc.EventListener.Add(ctx, category)
+	cp := mongo.NewProcessor[*Image](cc.Cache, nil, nil, nil)
+	categories := &inMemory[*Image]{
+		CacheWithEventListener: cc,
+		Mongo:                  &mongo.Mongo[*Image]{Processor: cp, Remover: &txRemover{c: cc}},
+	}
+
+	pc := NewCacheWithEventListener[*Image](nil, nil, nil)
+	orig := category.ID()
+	post := &Image{Orig: &orig}
+	pc.EventListener.Add(ctx, post)
+	pp := &cascadeProcessor{c: pc}
+	posts := &inMemory[*Image]{
+		CacheWithEventListener: pc,
+		Mongo:                  &mongo.Mongo[*Image]{Processor: pp, Searcher: &refSearcher{its: []*Image{post}}},
+	}
+
+	r := NewRefs()
+	r.register("categories", categories, nil)
+	r.register("posts", posts, []mongo.RefField{{Field: "orig", Collection: "categories", OnDelete: mongo.OnDeleteCascade}})
+	cp.SetReferences("categories", r)
+
+	// the cascade is applied once the transaction is committed, outside of it
+	assert.NoError(t, NewTx(client).Run(ctx, categories.DeleteOp(category)))
+	assert.False(t, pp.inTxn)
+	assert.Equal(t, []string{post.ID()}, pp.deleted)
+	_, found := cc.Cache.Get(ctx, category.ID())
+	assert.False(t, found)
+	_, found = pc.Cache.Get(ctx, post.ID())
+	assert.False(t, found)
+}
@@ -20,9 +20,16 @@ type searcher[T d] interface {
 type processor[T d] interface {
 	Create(ctx context.Context, ps T) (id string, err error)
 	Update(ctx context.Context, ps T) (T, error)
+	UpdateIf(ctx context.Context, ps T, cond bson.D) (T, error)
 	Delete(ctx context.Context, id string) (err error)
 	PrepareCreate(ctx context.Context, ps T) (prepared T, doc bson.D, err error)
 	PrepareUpdate(ctx context.Context, ps T) (prepared T, set bson.D, unset bson.D, err error)
+	PrepareDelete(ctx context.Context, id string) (err error)
+	CompleteDelete(ctx context.Context, id string) (err error)
+	CreateMany(ctx context.Context, ps []T) (errs []error, err error)
+	UpdateMany(ctx context.Context, ps []T) (errs []error, err error)
+	DeleteMany(ctx context.Context, ids []string) (errs []error, err error)
+	Upsert(ctx context.Context, ps T) (created bool, err error)
 }
 
 type d interface {
@@ -45,9 +52,13 @@ type creator interface {
 
 type updater interface {
 	UpdateOne(ctx context.Context, id string, version *int64, set bson.D, unset bson.D) (found bool, err error)
+	UpdateOneIf(ctx context.Context, id string, version *int64, cond bson.D, set bson.D, unset bson.D) (found bool, err error)
+	UpdateOps(ctx context.Context, id string, version *int64, u *Update) (found bool, err error)
+	UpdateMany(ctx context.Context, filter interface{}, set bson.D) (matched int, err error)
 }
 
 type upserter interface {
+	Upsert(ctx context.Context, id string, version *int64, set bson.D, unset bson.D) (created bool, err error)
 	UpsertOne(ctx context.Context, id string, doc interface{}) (err error)
 	UpsertMany(ctx context.Context, ids []string, set []interface{}) (err error)
 }
@@ -65,6 +76,44 @@ type handler[T d] interface {
 	Delete(ctx context.Context, _id primitive.ObjectID)
 }
 
+// replaceHandler is implemented by handlers which apply a replace event as a full document swap.
+// Handlers without it receive replaced documents through Add.
+type replaceHandler[T d] interface {
+	Replace(ctx context.Context, v T)
+}
+
+// fieldsHandler is implemented by handlers which change only the fields present in an update event
+// (the bson names of the top-level keys of updatedFields), so zero values are applied and absent fields are kept.
+type fieldsHandler[T d] interface {
+	UpdateFields(ctx context.Context, id primitive.ObjectID, updatedFields T, fields []string, removedFields []string)
+}
+
+// patchHandler is implemented by handlers which apply dotted paths and truncated arrays of an update
+// to the cached entity. Patch reports false if the entity is not cached (the event is then applied as a regular update).
+type patchHandler interface {
+	Patch(ctx context.Context, _id primitive.ObjectID, patch *Patch) (applied bool)
+}
+
+// preImageHandler is implemented by handlers which feed listeners the exact pre-image of a change
+// instead of the state found in the cache.
+type preImageHandler[T d] interface {
+	ReplaceWithPreImage(ctx context.Context, before, v T)
+	DeleteWithPreImage(ctx context.Context, _id primitive.ObjectID, before T)
+}
+
+// preImageUpdateHandler is implemented by handlers which feed listeners the exact pre-image of an update event
+// applied without a post-image: PatchWithPreImage applies the dotted paths to the pre-image, UpdateFieldsWithPreImage
+// changes the fields present in the event (all non-zero fields if fields is nil) like UpdateFields.
+type preImageUpdateHandler[T d] interface {
+	UpdateFieldsWithPreImage(ctx context.Context, id primitive.ObjectID, before, updatedFields T, fields []string, removedFields []string)
+	PatchWithPreImage(ctx context.Context, _id primitive.ObjectID, before T, patch *Patch) (applied bool)
+}
+
+// clearHandler is implemented by handlers which clear the projection after a drop, rename or invalidate event.
+type clearHandler interface {
+	Clear(ctx context.Context)
+}
+
 type remover interface {
 	Remove(ctx context.Context, doc interface{}) (deletedCount int, err error)
 	RemoveMany(ctx context.Context, doc interface{}) (deletedCount int, err error)
@@ -108,13 +157,50 @@ func NewMongo[T d](
 	cr := NewCreator(client, db, collection, connectionTimeout)
 	up := NewUpdater(client, db, collection, connectionTimeout)
 	rm := NewRemover(client, db, collection, connectionTimeout)
+	p := NewProcessor[T](cache, cr, up, rm)
+	us := NewUpsert(client, db, collection, connectionTimeout)
+	p.SetBulkWriter(NewBulkWriter(client, db, collection, connectionTimeout))
+	p.SetUpserter(us)
 	return &Mongo[T]{
 		Searcher:  NewSearcher[T](client, db, collection, connectionTimeout),
-		Processor: NewProcessor[T](cache, cr, up, rm),
+		Processor: p,
 		Listener:  NewListener(collection, handler),
 		Creator:   cr,
 		Updater:   up,
-		Upserter:  NewUpsert(client, db, collection, connectionTimeout),
+		Upserter:  us,
 		Remover:   rm,
 	}
 }
+
+// SetOnCollectionEvent registers a callback for drop, rename, dropDatabase and invalidate events of the collection.
+// See Listener.SetOnCollectionEvent.
+func (m *Mongo[T]) SetOnCollectionEvent(callback func(ctx context.Context, event CollectionEvent)) {
+	if l, ok := m.Listener.(*Listener[T]); ok {
+		l.SetOnCollectionEvent(callback)
+	}
+}
+
+// SetHooks sets the write hooks of the Processor. See Hooks.
+func (m *Mongo[T]) SetHooks(hooks Hooks[T]) {
+	if p, ok := m.Processor.(*Processor[T]); ok {
+		p.SetHooks(hooks)
+	}
+}
+
+// SetImages selects the document images applied by the Listener. See Listener.SetImages.
+func (m *Mongo[T]) SetImages(images Images) {
+	if l, ok := m.Listener.(*Listener[T]); ok {
+		l.SetImages(images)
+	}
+}
+
+// SetProjection restricts the fields of the documents loaded by the Searcher and applied by the Listener
+// (nil means full documents). See Projection.
+func (m *Mongo[T]) SetProjection(projection *Projection) {
+	if s, ok := m.Searcher.(*Searcher[T]); ok {
+		s.SetProjection(projection)
+	}
+	if l, ok := m.Listener.(*Listener[T]); ok {
+		l.SetProjection(projection)
+	}
+}
@@ -0,0 +1,85 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkWriter handles unordered bulk write operations in MongoDB.
+type BulkWriter struct {
+	client            *mongo.Client
+	db                string
+	collection        string
+	connectionTimeout time.Duration
+}
+
+// BulkWrite executes the write models as a single unordered bulk write:
+// a failed write does not stop the others. errs maps the index of each failed model to its write error;
+// err is returned when the whole bulk write fails (e.g. a network or write concern error).
+func (s *BulkWriter) BulkWrite(ctx context.Context, models []mongo.WriteModel) (res *mongo.BulkWriteResult, errs map[int]error, err error) {
+	if len(models) == 0 {
+		return &mongo.BulkWriteResult{}, nil, nil
+	}
+	collection := s.client.Database(s.db).Collection(s.collection)
+	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
+	defer cancel()
+	res, err = collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && bwe.WriteConcernError == nil && len(bwe.WriteErrors) > 0 {
+		errs = make(map[int]error, len(bwe.WriteErrors))
+		for _, we := range bwe.WriteErrors {
+			errs[we.Index] = we
+		}
+		err = nil
+	}
+	if res == nil {
+		res = &mongo.BulkWriteResult{}
+	}
+	return
+}
+
+// Written returns the IDs of the documents which have the given versions (document ID -> version).
+func (s *BulkWriter) Written(ctx context.Context, versions map[primitive.ObjectID]int64) (written map[primitive.ObjectID]bool, err error) {
+	collection := s.client.Database(s.db).Collection(s.collection)
+	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
+	defer cancel()
+	or := make(bson.A, 0, len(versions))
+	for id, version := range versions {
+		or = append(or, bson.D{{Key: "_id", Value: id}, {Key: "version", Value: version}})
+	}
+	cur, err := collection.Find(
+		ctx,
+		bson.D{{Key: "$or", Value: or}},
+		options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cur.All(ctx, &docs); err != nil {
+		return
+	}
+	written = make(map[primitive.ObjectID]bool, len(docs))
+	for _, doc := range docs {
+		written[doc.ID] = true
+	}
+	return
+}
+
+// NewBulkWriter creates a new BulkWriter instance for the specified database and collection.
+func NewBulkWriter(client *mongo.Client, db string, collection string, connectionTimeout time.Duration) *BulkWriter {
+	return &BulkWriter{
+		client:            client,
+		db:                db,
+		collection:        collection,
+		connectionTimeout: connectionTimeout,
+	}
+}
@@ -0,0 +1,256 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDeadLetterNotFound is returned by Stream.Replay when the quarantined event does not exist.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a quarantined Change Stream event: the raw event whose dispatch failed or panicked, with the error.
+type DeadLetter struct {
+	ID         string    `bson:"_id"`
+	DB         string    `bson:"db"`
+	Collection string    `bson:"collection"`
+	Event      bson.Raw  `bson:"event"`
+	Error      string    `bson:"error"`
+	Panic      bool      `bson:"panic"`
+	Attempts   int       `bson:"attempts"` // failed replays
+	At         time.Time `bson:"at"`
+}
+
+// DeadLetterSink stores quarantined events (see Stream.SetDeadLetter).
+type DeadLetterSink interface {
+	Put(ctx context.Context, letter DeadLetter) (err error)
+	Get(ctx context.Context, id string) (letter DeadLetter, found bool, err error)
+	List(ctx context.Context) (letters []DeadLetter, err error)
+	Remove(ctx context.Context, id string) (err error)
+}
+
+// DeadLetterRing is an in-memory DeadLetterSink keeping the last quarantined events:
+// when it is full, the oldest event is dropped.
+type DeadLetterRing struct {
+	mu       sync.Mutex
+	capacity int
+	letters  []DeadLetter
+}
+
+// NewDeadLetterRing creates a DeadLetterRing keeping up to capacity events (100 by default).
+func NewDeadLetterRing(capacity int) *DeadLetterRing {
+	if capacity <= 0 {
+		capacity = 100
+	}
+	return &DeadLetterRing{capacity: capacity}
+}
+
+// Put adds the event, or replaces the event with the same ID.
+func (r *DeadLetterRing) Put(ctx context.Context, letter DeadLetter) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.letters {
+		if r.letters[i].ID == letter.ID {
+			r.letters[i] = letter
+			return
+		}
+	}
+	if len(r.letters) == r.capacity {
+		zerolog.Ctx(ctx).Warn().Str("id", r.letters[0].ID).Msg("dead letter ring is full, oldest event dropped")
+		r.letters[0] = DeadLetter{}
+		r.letters = r.letters[1:]
+	}
+	r.letters = append(r.letters, letter)
+	return
+}
+
+// Get ...
+func (r *DeadLetterRing) Get(ctx context.Context, id string) (letter DeadLetter, found bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.letters {
+		if l.ID == id {
+			return l, true, nil
+		}
+	}
+	return
+}
+
+// List returns the events from the oldest.
+func (r *DeadLetterRing) List(ctx context.Context) (letters []DeadLetter, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append(letters, r.letters...), nil
+}
+
+// Remove ...
+func (r *DeadLetterRing) Remove(ctx context.Context, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.letters {
+		if r.letters[i].ID == id {
+			r.letters = append(r.letters[:i], r.letters[i+1:]...)
+			return
+		}
+	}
+	return
+}
+
+// DeadLetterCollection is a DeadLetterSink storing the quarantined events in a MongoDB collection.
+type DeadLetterCollection struct {
+	collection *mongo.Collection
+}
+
+// NewDeadLetterCollection creates a DeadLetterSink storing the events in the collection.
+func NewDeadLetterCollection(collection *mongo.Collection) *DeadLetterCollection {
+	return &DeadLetterCollection{collection: collection}
+}
+
+// Put ...
+func (c *DeadLetterCollection) Put(ctx context.Context, letter DeadLetter) (err error) {
+	_, err = c.collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: letter.ID}}, letter, options.Replace().SetUpsert(true))
+	return
+}
+
+// Get ...
+func (c *DeadLetterCollection) Get(ctx context.Context, id string) (letter DeadLetter, found bool, err error) {
+	err = c.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&letter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return letter, false, nil
+	}
+	return letter, err == nil, err
+}
+
+// List returns the events from the oldest.
+func (c *DeadLetterCollection) List(ctx context.Context) (letters []DeadLetter, err error) {
+	cur, err := c.collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}}))
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, &letters)
+	return
+}
+
+// Remove ...
+func (c *DeadLetterCollection) Remove(ctx context.Context, id string) (err error) {
+	_, err = c.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	return
+}
+
+// SetDeadLetter makes the Stream quarantine the events whose dispatch fails or panics into the sink,
+// instead of only logging them. Quarantined events are listed by DeadLetters and dispatched again by Replay.
+func (s *Stream) SetDeadLetter(sink DeadLetterSink) {
+	s.Lock()
+	defer s.Unlock()
+	s.deadLetter = sink
+}
+
+// DeadLetters lists the quarantined events.
+func (s *Stream) DeadLetters(ctx context.Context) (letters []DeadLetter, err error) {
+	sink := s.sink()
+	if sink == nil {
+		return
+	}
+	return sink.List(ctx)
+}
+
+// Replay dispatches a quarantined event again to the current listeners of its namespace.
+// The event is removed from the sink if the dispatch succeeds; otherwise its error and attempts are updated.
+// Listeners should tolerate events they have already applied, since a failed event may have been applied
+// by some of its listeners.
+func (s *Stream) Replay(ctx context.Context, id string) (err error) {
+	sink := s.sink()
+	if sink == nil {
+		return ErrDeadLetterNotFound
+	}
+	letter, found, err := sink.Get(ctx, id)
+	if err != nil {
+		return
+	}
+	if !found {
+		return ErrDeadLetterNotFound
+	}
+	if err = s.dispatch(ctx, letter.DB, letter.Event); err != nil {
+		var p *panicError
+		letter.Error, letter.Panic = err.Error(), errors.As(err, &p)
+		letter.Attempts++
+		if e := sink.Put(ctx, letter); e != nil {
+			zerolog.Ctx(ctx).Err(e).Str("id", id).Msg("dead letter: update replayed event")
+		}
+		return
+	}
+	return sink.Remove(ctx, id)
+}
+
+// Discard removes a quarantined event without dispatching it.
+func (s *Stream) Discard(ctx context.Context, id string) (err error) {
+	sink := s.sink()
+	if sink == nil {
+		return
+	}
+	return sink.Remove(ctx, id)
+}
+
+func (s *Stream) sink() DeadLetterSink {
+	s.RLock()
+	defer s.RUnlock()
+	return s.deadLetter
+}
+
+// quarantine puts an event of a Change Stream of the database whose dispatch failed into the dead-letter sink.
+func (s *Stream) quarantine(ctx context.Context, db string, event bson.Raw, err error) {
+	logger := zerolog.Ctx(ctx)
+	sink := s.sink()
+	if sink == nil {
+		return
+	}
+	var tp StreamingNS
+	_ = bson.Unmarshal(event, &tp)
+	if tp.NS.Db == "" {
+		// Invalidate events have no namespace: they are replayed to the listeners of the Change Stream.
+		tp.NS.Db = db
+	}
+	var p *panicError
+	letter := DeadLetter{
+		ID:         uuid.NewString(),
+		DB:         tp.NS.Db,
+		Collection: tp.NS.Coll,
+		Event:      append(bson.Raw(nil), event...),
+		Error:      err.Error(),
+		Panic:      errors.As(err, &p),
+		At:         time.Now().UTC(),
+	}
+	if e := sink.Put(ctx, letter); e != nil {
+		logger.Err(e).Str("error", err.Error()).Msg("dead letter: quarantine event")
+		return
+	}
+	logger.Warn().Str("id", letter.ID).Str("db", letter.DB).Str("collection", letter.Collection).
+		Str("error", letter.Error).Msg("event quarantined")
+}
+
+// panicError is a recovered panic of the dispatch of an event.
+type panicError struct {
+	recovered any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.recovered)
+}
+
+// recoverDispatch turns a panic of the dispatch of an event into an error.
+func recoverDispatch(ctx context.Context, err *error) {
+	if r := recover(); r != nil {
+		zerolog.Ctx(ctx).Error().Str("panic", fmt.Sprint(r)).Bytes("stack", debug.Stack()).
+			Msg("processing stream: recovered panic")
+		*err = &panicError{recovered: r}
+	}
+}
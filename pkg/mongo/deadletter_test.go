@@ -0,0 +1,90 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type poisonListener struct {
+	panics bool
+	err    error
+	events int
+}
+
+func (l *poisonListener) Listen(ctx context.Context, change []byte) (err error) {
+	if l.panics {
+		panic("poison")
+	}
+	if l.err != nil {
+		return l.err
+	}
+	l.events++
+	return
+}
+
+func TestDeadLetterRing(t *testing.T) {
+	ctx := context.Background()
+	ring := mongo.NewDeadLetterRing(2)
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, ring.Put(ctx, mongo.DeadLetter{ID: id}))
+	}
+	letters, err := ring.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "3"}, []string{letters[0].ID, letters[1].ID})
+
+	require.NoError(t, ring.Put(ctx, mongo.DeadLetter{ID: "2", Attempts: 1}))
+	letter, found, err := ring.Get(ctx, "2")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, letter.Attempts)
+
+	require.NoError(t, ring.Remove(ctx, "2"))
+	_, found, _ = ring.Get(ctx, "2")
+	assert.False(t, found)
+}
+
+func TestStream_Replay(t *testing.T) {
+	ctx := context.Background()
+	listener := &poisonListener{panics: true}
+	s := mongo.NewStream(nil, map[string]map[string]mongo.StreamListener{})
+	s.AddListener(ctx, "db", "files", listener)
+	ring := mongo.NewDeadLetterRing(10)
+	s.SetDeadLetter(ring)
+
+	event, err := bson.Marshal(bson.D{
+		{Key: "operationType", Value: mongo.InsertOperationType},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "db"}, {Key: "coll", Value: "files"}}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ring.Put(ctx, mongo.DeadLetter{ID: "1", DB: "db", Collection: "files", Event: event, At: time.Now()}))
+
+	// A panicking listener is recovered and the event stays quarantined.
+	err = s.Replay(ctx, "1")
+	assert.ErrorContains(t, err, "panic: poison")
+	letters, err := s.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.True(t, letters[0].Panic)
+	assert.Equal(t, 1, letters[0].Attempts)
+
+	listener.panics, listener.err = false, errors.New("failed")
+	assert.ErrorContains(t, s.Replay(ctx, "1"), "failed")
+	letters, _ = s.DeadLetters(ctx)
+	assert.False(t, letters[0].Panic)
+	assert.Equal(t, 2, letters[0].Attempts)
+
+	listener.err = nil
+	assert.NoError(t, s.Replay(ctx, "1"))
+	assert.Equal(t, 1, listener.events)
+	letters, _ = s.DeadLetters(ctx)
+	assert.Empty(t, letters)
+	assert.ErrorIs(t, s.Replay(ctx, "1"), mongo.ErrDeadLetterNotFound)
+}
@@ -0,0 +1,104 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Hooks are called by the Processor before a write is sent to MongoDB.
+// A hook can reject the write by returning an error, which is wrapped in a HookError,
+// or mutate it by returning a changed document (e.g. to set audit fields or normalize values).
+// Unlike the listeners of a projection, which are called for change events, hooks run before the write.
+type Hooks[T d] struct {
+	// BeforeCreate is called with the entity and its prepared document; it returns the document to insert.
+	BeforeCreate func(ctx context.Context, ps T, doc bson.D) (bson.D, error)
+	// BeforeUpdate is called with the cached entity, the changed entity and the prepared diff;
+	// it returns the diff to apply. An empty set makes the update a no-op (ErrNothingToUpdate).
+	BeforeUpdate func(ctx context.Context, current, ps T, set, unset bson.D) (bson.D, bson.D, error)
+	// BeforeDelete is called with the ID and the cached entity (the zero value if it is not cached).
+	BeforeDelete func(ctx context.Context, id string, current T) error
+}
+
+// HookError is returned when a write hook rejects a write.
+type HookError struct {
+	Op  string // create, update or delete
+	ID  string
+	Err error
+}
+
+// Error ...
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s %s rejected: %v", e.Op, e.ID, e.Err)
+}
+
+// Unwrap ...
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// SetHooks sets the write hooks called by the Processor.
+func (p *Processor[T]) SetHooks(hooks Hooks[T]) {
+	p.hooks = hooks
+}
+
+// PrepareDelete calls the BeforeDelete hook for the entity with the given ID and checks that
+// its delete is not restricted by a reference to it (see SetReferences). It does not write,
+// so a batch can be checked as a whole before any of it is deleted.
+// It is called by Delete and DeleteMany; writers which remove documents directly call it themselves,
+// then call CompleteDelete once the document is deleted.
+func (p *Processor[T]) PrepareDelete(ctx context.Context, id string) (err error) {
+	if err = p.beforeDelete(ctx, id); err != nil {
+		return
+	}
+	if p.refs != nil {
+		err = p.refs.CheckDelete(ctx, p.collection, id)
+	}
+	return
+}
+
+// CompleteDelete applies the cascade and setnull on-delete policies of the references to the entity
+// with the given ID, after it is deleted (see SetReferences).
+func (p *Processor[T]) CompleteDelete(ctx context.Context, id string) (err error) {
+	if p.refs != nil {
+		err = p.refs.OnDelete(ctx, p.collection, id)
+	}
+	return
+}
+
+func (p *Processor[T]) beforeDelete(ctx context.Context, id string) (err error) {
+	if p.hooks.BeforeDelete == nil {
+		return
+	}
+	var current T
+	if p.cache != nil {
+		current, _ = p.cache.Get(ctx, id)
+	}
+	if err = p.hooks.BeforeDelete(ctx, id, current); err != nil {
+		return &HookError{Op: "delete", ID: id, Err: err}
+	}
+	return
+}
+
+func (p *Processor[T]) beforeCreate(ctx context.Context, ps T, doc bson.D) (bson.D, error) {
+	if p.hooks.BeforeCreate == nil {
+		return doc, nil
+	}
+	doc, err := p.hooks.BeforeCreate(ctx, ps, doc)
+	if err != nil {
+		return nil, &HookError{Op: "create", ID: ps.ID(), Err: err}
+	}
+	return doc, nil
+}
+
+func (p *Processor[T]) beforeUpdate(ctx context.Context, current, ps T, set, unset bson.D) (bson.D, bson.D, error) {
+	if p.hooks.BeforeUpdate == nil {
+		return set, unset, nil
+	}
+	set, unset, err := p.hooks.BeforeUpdate(ctx, current, ps, set, unset)
+	if err != nil {
+		return nil, nil, &HookError{Op: "update", ID: ps.ID(), Err: err}
+	}
+	return set, unset, nil
+}
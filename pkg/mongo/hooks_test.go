@@ -0,0 +1,68 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+func TestProcessor_Hooks(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*V](map[string]*V{})
+	p := mongo.NewProcessor[*V](c, nil, nil, nil)
+	errLocked := errors.New("locked")
+	var current *V
+	p.SetHooks(mongo.Hooks[*V]{
+		BeforeCreate: func(ctx context.Context, ps *V, doc bson.D) (bson.D, error) {
+			if ps.PName == "" {
+				return nil, errors.New("name is required")
+			}
+			return append(doc, bson.E{Key: "createdBy", Value: "test"}), nil
+		},
+		BeforeUpdate: func(ctx context.Context, cur, ps *V, set, unset bson.D) (bson.D, bson.D, error) {
+			current = cur
+			return append(set, bson.E{Key: "updatedBy", Value: "test"}), unset, nil
+		},
+		BeforeDelete: func(ctx context.Context, id string, cur *V) error {
+			if cur != nil && cur.PName == name2 {
+				return errLocked
+			}
+			return nil
+		},
+	})
+
+	// create: mutated or rejected
+	_, doc, err := p.PrepareCreate(ctx, &V{PName: name1})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.E{Key: "createdBy", Value: "test"}, doc[len(doc)-1])
+	_, _, err = p.PrepareCreate(ctx, &V{})
+	var hookErr *mongo.HookError
+	assert.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, "create", hookErr.Op)
+
+	// update: called with the cached entity and the diff, only if there are changes
+	v := &V{D: D{V: &version1}, PName: name1}
+	c.Add(ctx, v)
+	_, set, _, err := p.PrepareUpdate(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: name1})
+	assert.NoError(t, err)
+	assert.Empty(t, set)
+	assert.Nil(t, current)
+	_, set, _, err = p.PrepareUpdate(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: name2})
+	assert.NoError(t, err)
+	assert.Equal(t, v, current)
+	assert.Equal(t, bson.E{Key: "updatedBy", Value: "test"}, set[len(set)-1])
+
+	// delete: rejected before the remover is called
+	assert.NoError(t, p.PrepareDelete(ctx, v.ID()))
+	c.Add(ctx, &V{D: D{Id: v.Id, V: &version2}, PName: name2})
+	err = p.Delete(ctx, v.ID())
+	assert.ErrorIs(t, err, errLocked)
+	assert.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, "delete", hookErr.Op)
+}
@@ -1,6 +1,7 @@
 package mongo
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 
@@ -14,26 +15,131 @@ const (
 	UpdateOperationType = "update"
 	// DeleteOperationType represents a delete operation in MongoDB Change Streams.
 	DeleteOperationType = "delete"
+	// ReplaceOperationType represents a replace operation in MongoDB Change Streams.
+	ReplaceOperationType = "replace"
+	// DropOperationType represents a collection drop in MongoDB Change Streams.
+	DropOperationType = "drop"
+	// RenameOperationType represents a collection rename in MongoDB Change Streams.
+	RenameOperationType = "rename"
+	// DropDatabaseOperationType represents a database drop in MongoDB Change Streams.
+	DropDatabaseOperationType = "dropDatabase"
+	// InvalidateOperationType represents an invalidate event which closes a MongoDB Change Stream.
+	InvalidateOperationType = "invalidate"
 )
 
+// CollectionEvent is a collection-level Change Stream event (drop, rename, dropDatabase or invalidate).
+// After such an event the in-memory projection of the collection has been cleared.
+type CollectionEvent = StreamCollection
+
 // Listener processes MongoDB Change Stream events and applies them to the in-memory projection.
 // It decodes Change Stream events (insert, update, delete) and calls the appropriate
 // handler methods (Add, Update, Delete) to keep the in-memory cache synchronized.
 type Listener[T d] struct {
-	collection string
-	handler    handler[T]
+	collection        string
+	handler           handler[T]
+	projection        *Projection
+	images            Images
+	onCollectionEvent func(ctx context.Context, event CollectionEvent)
+}
+
+// Images selects the document images of Change Stream events applied by a Listener (both are opt-in).
+//
+// FullDocument applies the post-image fullDocument of update events atomically as a full document swap
+// instead of merging updateDescription.updatedFields; the Change Stream must be opened with
+// options.UpdateLookup, options.WhenAvailable or options.Required. Update events without a post-image
+// fall back to updatedFields.
+//
+// PreImages passes fullDocumentBeforeChange of update, replace and delete events to the handler,
+// so listeners receive the exact old entity. It requires MongoDB 6.0+, changeStreamPreAndPostImages
+// enabled on the collection and the Change Stream opened with SetFullDocumentBeforeChange.
+type Images struct {
+	FullDocument bool
+	PreImages    bool
+}
+
+// SetImages selects the document images applied from Change Stream events.
+func (s *Listener[T]) SetImages(images Images) {
+	s.images = images
+}
+
+// decodeImages decodes the post-image and the pre-image of an event according to the selected images.
+func (s *Listener[T]) decodeImages(change []byte) (after T, hasAfter bool, before T, hasBefore bool, err error) {
+	if !s.images.FullDocument && !s.images.PreImages {
+		return
+	}
+	var decoded StreamImages
+	if err = json.Unmarshal(change, &decoded); err != nil {
+		return
+	}
+	if s.images.FullDocument && isImage(decoded.FullDocument) {
+		if err = json.Unmarshal(decoded.FullDocument, &after); err != nil {
+			return
+		}
+		hasAfter = true
+		if s.projection != nil {
+			s.projection.Apply(after)
+		}
+	}
+	if s.images.PreImages && isImage(decoded.FullDocumentBeforeChange) {
+		if err = json.Unmarshal(decoded.FullDocumentBeforeChange, &before); err != nil {
+			return
+		}
+		hasBefore = true
+		if s.projection != nil {
+			s.projection.Apply(before)
+		}
+	}
+	return
+}
+
+func isImage(raw json.RawMessage) bool {
+	return len(raw) > 0 && !bytes.Equal(raw, []byte("null"))
+}
+
+// replace applies a full document, with its pre-image when the handler supports it.
+// It reports false if the handler cannot apply full documents.
+func (s *Listener[T]) replace(ctx context.Context, v T, before T, hasBefore bool) bool {
+	if p, ok := s.handler.(preImageHandler[T]); ok && hasBefore {
+		p.ReplaceWithPreImage(ctx, before, v)
+		return true
+	}
+	if r, ok := s.handler.(replaceHandler[T]); ok {
+		r.Replace(ctx, v)
+		return true
+	}
+	return false
+}
+
+// SetOnCollectionEvent registers a callback called after a drop, rename, dropDatabase or invalidate event
+// of the collection has been applied, so the service can react (e.g. resync the projection or stop).
+func (s *Listener[T]) SetOnCollectionEvent(callback func(ctx context.Context, event CollectionEvent)) {
+	s.onCollectionEvent = callback
+}
+
+// SetProjection restricts the fields applied from Change Stream events (nil means full documents).
+// Fields which are not kept are cleared from inserted documents and ignored in updates.
+func (s *Listener[T]) SetProjection(projection *Projection) {
+	s.projection = projection
 }
 
 // Listen processes a Change Stream event from MongoDB.
 // It decodes the event JSON, determines the operation type (insert/update/delete),
 // and calls the appropriate handler method to update the in-memory projection.
+// An event which cannot be decoded is logged and its decoding error is returned,
+// so the Stream quarantines it (see Stream.SetDeadLetter).
 func (s *Listener[T]) Listen(ctx context.Context, change []byte) (err error) {
 	logger := zerolog.Ctx(ctx)
 	// A new event variable should be declared for each event.
-	var tp StreamType
+	var tp struct {
+		StreamType
+		StreamTxn
+	}
 	if e := json.Unmarshal(change, &tp); e != nil {
 		logfWithError(logger, change, e, "error while decoding type from %s collection stream", s.collection)
-		return
+		return e
+	}
+	if txn, ok := tp.Txn(); ok {
+		ctx = WithTxn(ctx, txn)
 	}
 	logf(logger, change, "%s stream %s", s.collection, tp.OperationType)
 	switch tp.OperationType {
@@ -41,13 +147,74 @@ func (s *Listener[T]) Listen(ctx context.Context, change []byte) (err error) {
 		var decoded StreamInsert[T]
 		if e := json.Unmarshal(change, &decoded); e != nil {
 			logfWithError(logger, change, e, "error while decoding insert op from %s collection", s.collection)
-			return
+			return e
+		}
+		if s.projection != nil {
+			s.projection.Apply(decoded.FullDocument)
 		}
 		s.handler.Add(ctx, decoded.FullDocument)
 	case UpdateOperationType:
 		var decoded StreamUpdate[T]
 		if e := json.Unmarshal(change, &decoded); e != nil {
 			logfWithError(logger, change, e, "error while decoding update op from %s collection", s.collection)
+			return e
+		}
+		after, hasAfter, before, hasBefore, e := s.decodeImages(change)
+		if e != nil {
+			logfWithError(logger, change, e, "error while decoding update images from %s collection", s.collection)
+			return e
+		}
+		if hasAfter && s.replace(ctx, after, before, hasBefore) {
+			return
+		}
+		p, patchable := s.handler.(patchHandler)
+		f, present := s.handler.(fieldsHandler[T])
+		// Without a post-image, the pre-image is still passed to the handler as the old state.
+		pi, preImage := s.handler.(preImageUpdateHandler[T])
+		preImage = preImage && hasBefore
+		var patch StreamPatch
+		if patchable || present || preImage {
+			if e := json.Unmarshal(change, &patch); e != nil {
+				logfWithError(logger, change, e, "error while decoding update paths from %s collection", s.collection)
+				return e
+			}
+			patch.UpdateDescription.Restrict(s.projection)
+		}
+		if patch.UpdateDescription.IsNested() {
+			if preImage && pi.PatchWithPreImage(ctx, decoded.DocumentKey.ID, before, &patch.UpdateDescription) {
+				return
+			}
+			if !preImage && patchable && p.Patch(ctx, decoded.DocumentKey.ID, &patch.UpdateDescription) {
+				return
+			}
+		}
+		if s.projection != nil {
+			s.projection.Apply(decoded.UpdateDescription.UpdatedFields)
+			decoded.UpdateDescription.RemovedFields = s.projection.RemovedFields(decoded.UpdateDescription.RemovedFields)
+		}
+		if present || preImage {
+			fields := sortedKeys(patch.UpdateDescription.UpdatedFields)
+			if fields == nil {
+				fields = []string{}
+			}
+			if preImage {
+				pi.UpdateFieldsWithPreImage(
+					ctx,
+					decoded.DocumentKey.ID,
+					before,
+					decoded.UpdateDescription.UpdatedFields,
+					fields,
+					decoded.UpdateDescription.RemovedFields,
+				)
+				return
+			}
+			f.UpdateFields(
+				ctx,
+				decoded.DocumentKey.ID,
+				decoded.UpdateDescription.UpdatedFields,
+				fields,
+				decoded.UpdateDescription.RemovedFields,
+			)
 			return
 		}
 		s.handler.Update(
@@ -56,13 +223,52 @@ func (s *Listener[T]) Listen(ctx context.Context, change []byte) (err error) {
 			decoded.UpdateDescription.UpdatedFields,
 			decoded.UpdateDescription.RemovedFields,
 		)
+	case ReplaceOperationType:
+		var decoded StreamReplace[T]
+		if e := json.Unmarshal(change, &decoded); e != nil {
+			logfWithError(logger, change, e, "error while decoding replace op from %s collection", s.collection)
+			return e
+		}
+		if s.projection != nil {
+			s.projection.Apply(decoded.FullDocument)
+		}
+		_, _, before, hasBefore, e := s.decodeImages(change)
+		if e != nil {
+			logfWithError(logger, change, e, "error while decoding replace images from %s collection", s.collection)
+			return e
+		}
+		if s.replace(ctx, decoded.FullDocument, before, hasBefore) {
+			return
+		}
+		s.handler.Add(ctx, decoded.FullDocument)
 	case DeleteOperationType:
 		var decoded StreamDelete
 		if e := json.Unmarshal(change, &decoded); e != nil {
 			logfWithError(logger, change, e, "error while decoding delete operation from %s collection", s.collection)
+			return e
+		}
+		_, _, before, hasBefore, e := s.decodeImages(change)
+		if e != nil {
+			logfWithError(logger, change, e, "error while decoding delete images from %s collection", s.collection)
+			return e
+		}
+		if p, ok := s.handler.(preImageHandler[T]); ok && hasBefore {
+			p.DeleteWithPreImage(ctx, decoded.DocumentKey.ID, before)
 			return
 		}
-		s.handler.Delete(context.Background(), decoded.DocumentKey.ID)
+		s.handler.Delete(ctx, decoded.DocumentKey.ID)
+	case DropOperationType, RenameOperationType, DropDatabaseOperationType, InvalidateOperationType:
+		var decoded CollectionEvent
+		if e := json.Unmarshal(change, &decoded); e != nil {
+			logfWithError(logger, change, e, "error while decoding %s event from %s collection", tp.OperationType, s.collection)
+			return e
+		}
+		if c, ok := s.handler.(clearHandler); ok {
+			c.Clear(ctx)
+		}
+		if s.onCollectionEvent != nil {
+			s.onCollectionEvent(ctx, decoded)
+		}
 	}
 	return
 }
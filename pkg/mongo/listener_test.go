@@ -0,0 +1,130 @@
+package mongo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type recordingHandler struct {
+	added    []*V
+	replaced []*V
+	cleared  int
+}
+
+func (h *recordingHandler) Add(ctx context.Context, v *V) {
+	h.added = append(h.added, v)
+}
+
+func (h *recordingHandler) Update(ctx context.Context, id primitive.ObjectID, updatedFields *V, removedFields []string) {
+}
+
+func (h *recordingHandler) Delete(ctx context.Context, _id primitive.ObjectID) {
+}
+
+func (h *recordingHandler) Replace(ctx context.Context, v *V) {
+	h.replaced = append(h.replaced, v)
+}
+
+func (h *recordingHandler) Clear(ctx context.Context) {
+	h.cleared++
+}
+
+func TestListener_Replace(t *testing.T) {
+	h := &recordingHandler{}
+	l := mongo.NewListener[*V]("v", h)
+	err := l.Listen(context.Background(), []byte(`{"operationType":"replace","documentKey":{"_id":{"$oid":"65a000000000000000000001"}},"fullDocument":{"pname":"replaced"}}`))
+	assert.NoError(t, err)
+	assert.Empty(t, h.added)
+	assert.Len(t, h.replaced, 1)
+	assert.Equal(t, "replaced", h.replaced[0].PName)
+}
+
+func TestListener_DecodeError(t *testing.T) {
+	h := &recordingHandler{}
+	l := mongo.NewListener[*V]("v", h)
+	err := l.Listen(context.Background(), []byte(`{"operationType":"insert","fullDocument":{"pname":1}}`))
+	assert.Error(t, err)
+	assert.Empty(t, h.added)
+}
+
+func TestListener_CollectionEvents(t *testing.T) {
+	h := &recordingHandler{}
+	l := mongo.NewListener[*V]("v", h)
+	var events []mongo.CollectionEvent
+	l.SetOnCollectionEvent(func(ctx context.Context, event mongo.CollectionEvent) {
+		events = append(events, event)
+	})
+	for _, change := range []string{
+		`{"operationType":"drop","ns":{"db":"db","coll":"v"}}`,
+		`{"operationType":"rename","ns":{"db":"db","coll":"v"},"to":{"db":"db","coll":"w"}}`,
+		`{"operationType":"invalidate"}`,
+	} {
+		assert.NoError(t, l.Listen(context.Background(), []byte(change)))
+	}
+	assert.Equal(t, 3, h.cleared)
+	assert.Len(t, events, 3)
+	assert.Equal(t, mongo.DropOperationType, events[0].OperationType)
+	assert.Equal(t, "w", events[1].To.Coll)
+	assert.Equal(t, mongo.InvalidateOperationType, events[2].OperationType)
+}
+
+func TestListener_Images(t *testing.T) {
+	h := &recordingHandler{}
+	l := mongo.NewListener[*V]("v", h)
+	update := []byte(`{"operationType":"update","documentKey":{"_id":{"$oid":"65a000000000000000000001"}},"updateDescription":{"updatedFields":{"pname":"partial"}},"fullDocument":{"_id":{"$oid":"65a000000000000000000001"},"pname":"full"}}`)
+	assert.NoError(t, l.Listen(context.Background(), update))
+	assert.Empty(t, h.replaced)
+
+	l.SetImages(mongo.Images{FullDocument: true})
+	assert.NoError(t, l.Listen(context.Background(), update))
+	assert.Len(t, h.replaced, 1)
+	assert.Equal(t, "full", h.replaced[0].PName)
+}
+
+type fieldsHandler struct {
+	recordingHandler
+	fields []string
+}
+
+func (h *fieldsHandler) UpdateFields(ctx context.Context, id primitive.ObjectID, updatedFields *V, fields []string, removedFields []string) {
+	h.fields = fields
+}
+
+func TestListener_UpdateFields(t *testing.T) {
+	h := &fieldsHandler{}
+	l := mongo.NewListener[*V]("v", h)
+	assert.NoError(t, l.Listen(context.Background(), []byte(`{"operationType":"update","documentKey":{"_id":{"$oid":"65a000000000000000000001"}},"updateDescription":{"updatedFields":{"pnumber":0,"pname":""}}}`)))
+	assert.Equal(t, []string{"pname", "pnumber"}, h.fields)
+}
+
+type txnHandler struct {
+	recordingHandler
+	txn   mongo.Txn
+	found bool
+}
+
+func (h *txnHandler) Delete(ctx context.Context, _id primitive.ObjectID) {
+	h.txn, h.found = mongo.TxnFromContext(ctx)
+}
+
+func TestListener_Txn(t *testing.T) {
+	h := &txnHandler{}
+	l := mongo.NewListener[*V]("v", h)
+	assert.NoError(t, l.Listen(context.Background(), []byte(`{"operationType":"delete","documentKey":{"_id":{"$oid":"65a000000000000000000001"}},`+
+		`"lsid":{"id":{"$binary":{"base64":"q83vEjRWeJCrze8SNFZ4kA==","subType":"04"}},"uid":{"$binary":{"base64":"AA==","subType":"00"}}},"txnNumber":3}`)))
+	assert.True(t, h.found)
+	assert.Equal(t, mongo.Txn{SessionID: "q83vEjRWeJCrze8SNFZ4kA==", Number: 3}, h.txn)
+
+	id, err := bson.Marshal(bson.D{{Key: "id", Value: primitive.Binary{Subtype: 4, Data: []byte{0xab, 0xcd, 0xef, 0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef, 0x12, 0x34, 0x56, 0x78, 0x90}}}})
+	assert.NoError(t, err)
+	assert.Equal(t, h.txn.SessionID, mongo.SessionID(id))
+
+	assert.NoError(t, l.Listen(context.Background(), []byte(`{"operationType":"delete","documentKey":{"_id":{"$oid":"65a000000000000000000001"}}}`)))
+	assert.False(t, h.found)
+}
@@ -1,16 +1,21 @@
 package mongo
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // StreamingNS represents the namespace information in a Change Stream event.
 type StreamingNS struct {
-	NS NS `bson:"ns"`
+	NS            NS     `bson:"ns"`
+	OperationType string `bson:"operationType"`
 }
 
 // NS represents a MongoDB namespace (database and collection).
 type NS struct {
-	Db   string `bson:"db"`
-	Coll string `bson:"coll"`
+	Db   string `json:"db" bson:"db"`
+	Coll string `json:"coll" bson:"coll"`
 }
 
 // ===================================
@@ -35,6 +40,35 @@ type StreamUpdate[T any] struct {
 	UpdateDescription UpdateDescription[T] `json:"updateDescription" bson:"updateDescription"`
 }
 
+// StreamPatch represents the update description of an update operation in its path-aware form (see Patch).
+type StreamPatch struct {
+	UpdateDescription Patch `json:"updateDescription" bson:"updateDescription"`
+}
+
+// StreamReplace represents a replace operation in a Change Stream event.
+// It contains the document key and the full replacement document.
+type StreamReplace[T any] struct {
+	DocumentKey  DocumentKey `json:"documentKey" bson:"documentKey"`
+	FullDocument T           `json:"fullDocument" bson:"fullDocument"`
+}
+
+// StreamCollection represents a collection-level event (drop, rename, dropDatabase, invalidate) in a Change Stream.
+// To is set for rename events only.
+type StreamCollection struct {
+	OperationType string `json:"operationType" bson:"operationType"`
+	NS            NS     `json:"ns" bson:"ns"`
+	To            *NS    `json:"to" bson:"to"`
+}
+
+// StreamImages represents the document images of a Change Stream event:
+// the post-image fullDocument (update events opened with options.UpdateLookup, WhenAvailable or Required)
+// and the pre-image fullDocumentBeforeChange (collections with changeStreamPreAndPostImages, MongoDB 6.0+).
+// Missing images are null or empty.
+type StreamImages struct {
+	FullDocument             json.RawMessage `json:"fullDocument" bson:"fullDocument"`
+	FullDocumentBeforeChange json.RawMessage `json:"fullDocumentBeforeChange" bson:"fullDocumentBeforeChange"`
+}
+
 // StreamDelete represents a delete operation in a Change Stream event.
 // It contains the document key of the deleted document.
 type StreamDelete struct {
@@ -0,0 +1,212 @@
+package mongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TruncatedArray describes an array field truncated by an update (updateDescription.truncatedArrays).
+type TruncatedArray struct {
+	Field   string `json:"field" bson:"field"`
+	NewSize int    `json:"newSize" bson:"newSize"`
+}
+
+// Patch is the path-aware form of an update event description.
+// MongoDB reports nested changes as dotted paths (address.city, items.3.qty) and shrunk arrays
+// in truncatedArrays; they cannot be decoded into T directly and are applied to the cached entity instead.
+type Patch struct {
+	UpdatedFields   map[string]json.RawMessage `json:"updatedFields" bson:"updatedFields"`
+	RemovedFields   []string                   `json:"removedFields" bson:"removedFields"`
+	TruncatedArrays []TruncatedArray           `json:"truncatedArrays" bson:"truncatedArrays"`
+}
+
+// IsNested reports whether the patch has dotted paths or truncated arrays,
+// i.e. whether it must be applied to the cached entity rather than decoded into T.
+func (p *Patch) IsNested() bool {
+	if len(p.TruncatedArrays) > 0 {
+		return true
+	}
+	for k := range p.UpdatedFields {
+		if strings.Contains(k, ".") {
+			return true
+		}
+	}
+	for _, k := range p.RemovedFields {
+		if strings.Contains(k, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Restrict drops the paths which are not kept by the projection.
+func (p *Patch) Restrict(projection *Projection) {
+	if projection == nil {
+		return
+	}
+	for k := range p.UpdatedFields {
+		if !projection.Keep(k) {
+			delete(p.UpdatedFields, k)
+		}
+	}
+	p.RemovedFields = projection.RemovedFields(p.RemovedFields)
+	truncated := p.TruncatedArrays[:0]
+	for _, t := range p.TruncatedArrays {
+		if projection.Keep(t.Field) {
+			truncated = append(truncated, t)
+		}
+	}
+	p.TruncatedArrays = truncated
+}
+
+// Apply applies the patch to a decoded document: arrays are truncated first,
+// then updated paths are set (zero values included) and removed paths are unset.
+// Numeric path segments address array elements; missing intermediate documents are created.
+func (p *Patch) Apply(doc map[string]any) (err error) {
+	for _, t := range p.TruncatedArrays {
+		if err = patchPath(doc, t.Field, func(parent any, key string) (any, error) {
+			return truncate(parent, key, t.NewSize)
+		}); err != nil {
+			return
+		}
+	}
+	for _, path := range sortedKeys(p.UpdatedFields) {
+		var v any
+		if v, err = decodeJSON(p.UpdatedFields[path]); err != nil {
+			return fmt.Errorf("patch %s: %w", path, err)
+		}
+		if err = patchPath(doc, path, func(parent any, key string) (any, error) {
+			return set(parent, key, v)
+		}); err != nil {
+			return
+		}
+	}
+	for _, path := range p.RemovedFields {
+		if err = patchPath(doc, path, unset); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ApplyPatch applies the patch to a copy of v and returns the patched entity.
+// The entity is round-tripped through JSON, as Change Stream events are decoded by the Listener.
+func ApplyPatch[T d](v T, p *Patch) (patched T, err error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	decoded, err := decodeJSON(b)
+	if err != nil {
+		return
+	}
+	doc, ok := decoded.(map[string]any)
+	if !ok {
+		return patched, fmt.Errorf("patch: entity is not a document")
+	}
+	if err = p.Apply(doc); err != nil {
+		return
+	}
+	if b, err = json.Marshal(doc); err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &patched)
+	return
+}
+
+func decodeJSON(b []byte) (v any, err error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	err = dec.Decode(&v)
+	return
+}
+
+// patchPath walks the path to the parent of its last segment and replaces the parent with the result of fn.
+func patchPath(doc map[string]any, path string, fn func(parent any, key string) (any, error)) (err error) {
+	segments := strings.Split(path, ".")
+	_, err = walk(doc, segments, fn)
+	if err != nil {
+		err = fmt.Errorf("patch %s: %w", path, err)
+	}
+	return
+}
+
+func walk(node any, segments []string, fn func(parent any, key string) (any, error)) (any, error) {
+	if len(segments) == 1 {
+		return fn(node, segments[0])
+	}
+	key := segments[0]
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[key]
+		if !ok || child == nil {
+			child = map[string]any{}
+		}
+		child, err := walk(child, segments[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[key] = child
+		return n, nil
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, fmt.Errorf("no array element %s", key)
+		}
+		child, err := walk(n[i], segments[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%s is not a document or an array", key)
+	}
+}
+
+func set(parent any, key string, v any) (any, error) {
+	switch n := parent.(type) {
+	case map[string]any:
+		n[key] = v
+		return n, nil
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("invalid array index %s", key)
+		}
+		for len(n) <= i {
+			n = append(n, nil)
+		}
+		n[i] = v
+		return n, nil
+	default:
+		return nil, fmt.Errorf("cannot set %s", key)
+	}
+}
+
+func unset(parent any, key string) (any, error) {
+	switch n := parent.(type) {
+	case map[string]any:
+		delete(n, key)
+	case []any:
+		// $unset of an array element sets it to null.
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(n) {
+			n[i] = nil
+		}
+	}
+	return parent, nil
+}
+
+func truncate(parent any, key string, size int) (any, error) {
+	n, ok := parent.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("cannot truncate %s", key)
+	}
+	if a, ok := n[key].([]any); ok && size < len(a) {
+		n[key] = a[:size]
+	}
+	return n, nil
+}
@@ -0,0 +1,90 @@
+package mongo_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type Item struct {
+	Sku *string `json:"sku"`
+	Qty *int    `json:"qty"`
+}
+
+type Address struct {
+	City *string `json:"city"`
+	Zip  *string `json:"zip"`
+}
+
+type Cart struct {
+	Id      primitive.ObjectID `json:"_id"`
+	Count   *int               `json:"count"`
+	Active  *bool              `json:"active"`
+	Address *Address           `json:"address"`
+	Items   []Item             `json:"items"`
+}
+
+func (v *Cart) ID() string {
+	return v.Id.Hex()
+}
+
+func (v *Cart) Version() *int64 {
+	return nil
+}
+
+func (v *Cart) SetDeleted(bool) {}
+
+func TestApplyPatch(t *testing.T) {
+	one, two, three := 1, 2, 3
+	city, zip := "Berlin", "10115"
+	active := true
+	cart := &Cart{
+		Id:      primitive.NewObjectID(),
+		Count:   &three,
+		Active:  &active,
+		Address: &Address{City: &city, Zip: &zip},
+		Items:   []Item{{Qty: &one}, {Qty: &two}, {Qty: &three}},
+	}
+	var patch mongo.Patch
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"updatedFields": {"address.city": "Paris", "items.0.qty": 0, "items.2": {"sku": "new"}, "count": 0, "active": false},
+		"removedFields": ["address.zip"],
+		"truncatedArrays": [{"field": "items", "newSize": 2}]
+	}`), &patch))
+	assert.True(t, patch.IsNested())
+
+	patched, err := mongo.ApplyPatch(cart, &patch)
+	assert.NoError(t, err)
+	assert.Equal(t, cart.Id, patched.Id)
+	assert.Equal(t, 0, *patched.Count)
+	assert.False(t, *patched.Active)
+	assert.Equal(t, "Paris", *patched.Address.City)
+	assert.Nil(t, patched.Address.Zip)
+	assert.Len(t, patched.Items, 3)
+	assert.Equal(t, 0, *patched.Items[0].Qty)
+	assert.Equal(t, 2, *patched.Items[1].Qty)
+	assert.Equal(t, "new", *patched.Items[2].Sku)
+	assert.Nil(t, patched.Items[2].Qty)
+	// the original entity is not changed
+	assert.Equal(t, "Berlin", *cart.Address.City)
+
+	_, err = mongo.ApplyPatch(cart, &mongo.Patch{UpdatedFields: map[string]json.RawMessage{"items.9.qty": []byte(`1`)}})
+	assert.Error(t, err)
+}
+
+func TestPatch_Restrict(t *testing.T) {
+	patch := mongo.Patch{
+		UpdatedFields:   map[string]json.RawMessage{"address.city": []byte(`"Paris"`), "items.0.qty": []byte(`1`)},
+		RemovedFields:   []string{"items.1"},
+		TruncatedArrays: []mongo.TruncatedArray{{Field: "items", NewSize: 1}},
+	}
+	patch.Restrict(mongo.NewProjection([]string{"address"}))
+	assert.Len(t, patch.UpdatedFields, 1)
+	assert.Contains(t, patch.UpdatedFields, "address.city")
+	assert.Empty(t, patch.RemovedFields)
+	assert.Empty(t, patch.TruncatedArrays)
+}
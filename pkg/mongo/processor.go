@@ -3,9 +3,13 @@ package mongo
 import (
 	"bytes"
 	"context"
+	"encoding"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog"
@@ -21,6 +25,9 @@ var (
 	ErrNothingToCreate = errors.New("nothing to create")
 	// ErrNothingToUpdate is returned when there are no changes to apply (empty update).
 	ErrNothingToUpdate = errors.New("nothing to update")
+	// ErrPreconditionFailed is returned by a conditional write when the document does not match its condition,
+	// and by an upsert of an entity which is not cached when its document exists.
+	ErrPreconditionFailed = errors.New("precondition failed")
 )
 
 // Processor handles create, update, and delete operations for typed entities.
@@ -31,6 +38,12 @@ type Processor[T d] struct {
 	creator creator
 	updater updater
 	remover remover
+	bulk    bulkWriter
+	upsert  upserter
+	hooks   Hooks[T]
+	// collection and refs resolve the references of the entities (see SetReferences)
+	collection string
+	refs       References
 }
 
 // Create inserts a new entity into MongoDB.
@@ -86,8 +99,81 @@ func (p *Processor[T]) Update(ctx context.Context, ps T) (T, error) {
 	return ps, ErrNothingToUpdate
 }
 
+// UpdateIf applies the changes of the entity as Update does, if the document matches the condition
+// (a filter on its fields, e.g. bson.D{{Key: "status", Value: "pending"}}), as a single compare-and-set write.
+// ErrNotFound is returned if the entity is not cached, ErrPreconditionFailed if the document
+// does not match the condition or its version has advanced, and ErrNothingToUpdate if the entity
+// has no changes (nothing is written, so the condition is not checked).
+func (p *Processor[T]) UpdateIf(ctx context.Context, ps T, cond bson.D) (T, error) {
+	ps, set, unset, err := p.PrepareUpdate(ctx, ps)
+	if err != nil {
+		return ps, err
+	}
+	if len(set) == 0 {
+		return ps, ErrNothingToUpdate
+	}
+	f, err := p.updater.UpdateOneIf(ctx, ps.ID(), ps.Version(), cond, set, unset)
+	if err != nil {
+		return ps, err
+	}
+	if !f {
+		return ps, ErrPreconditionFailed
+	}
+	return ps, nil
+}
+
+// SetUpserter sets the upserter used by Upsert.
+func (p *Processor[T]) SetUpserter(upsert upserter) {
+	p.upsert = upsert
+}
+
+// Upsert creates the entity if it is not cached, otherwise updates it with optimistic locking on its version.
+// A cached entity is updated with the changed fields only (see Update); ErrNothingToUpdate is returned if
+// there are none, ErrNotFound if its version has advanced or it was deleted. An entity which is not cached is
+// inserted with all its fields only if the document does not exist: ErrPreconditionFailed is returned for an existing
+// document which is not cached (e.g. filtered out of the projection or soft-deleted), which is not overwritten.
+// created reports whether it was inserted.
+func (p *Processor[T]) Upsert(ctx context.Context, ps T) (created bool, err error) {
+	if p.upsert == nil {
+		return false, errors.New("upserter is not configured")
+	}
+	if p.cache != nil {
+		if _, found := p.cache.Get(ctx, ps.ID()); found {
+			var set, unset bson.D
+			if ps, set, unset, err = p.PrepareUpdate(ctx, ps); err != nil {
+				return
+			}
+			if len(set) == 0 {
+				return false, ErrNothingToUpdate
+			}
+			return p.upsert.Upsert(ctx, ps.ID(), ps.Version(), set, unset)
+		}
+	}
+	ps.SetDeleted(false)
+	_, doc, err := p.PrepareCreate(ctx, ps)
+	if err != nil {
+		return
+	}
+	if len(doc) == 0 {
+		return false, ErrNothingToCreate
+	}
+	return p.upsert.Upsert(ctx, ps.ID(), nil, removeID(doc), nil)
+}
+
+// removeID removes the _id field from a prepared document, which cannot be set by an update.
+func removeID(doc bson.D) bson.D {
+	res := make(bson.D, 0, len(doc))
+	for _, e := range doc {
+		if e.Key != "_id" {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
 // Delete removes an entity from MongoDB by its ID.
 // The ID should be a valid MongoDB ObjectID hex string.
+// The on-delete policies of the references to it are applied once it is removed (see CompleteDelete).
 func (p *Processor[T]) Delete(ctx context.Context, id string) (err error) {
 	logger := zerolog.Ctx(ctx)
 	_id, err := primitive.ObjectIDFromHex(id)
@@ -95,6 +181,9 @@ func (p *Processor[T]) Delete(ctx context.Context, id string) (err error) {
 		logger.Err(err).Str("id", id).Msg("Mongo:Processor:Delete:parse objectID from Hex")
 		return
 	}
+	if err = p.PrepareDelete(ctx, id); err != nil {
+		return
+	}
 	_, err = p.remover.Remove(ctx, bson.D{
 		bson.E{
 			Key:   "_id",
@@ -103,14 +192,18 @@ func (p *Processor[T]) Delete(ctx context.Context, id string) (err error) {
 	})
 	if err != nil {
 		logger.Err(err).Str("id", id).Msg("Mongo:Processor:Delete:remover:Remove")
+		return
 	}
-	return
+	return p.CompleteDelete(ctx, id)
 }
 
 // PrepareCreate prepares an entity for insertion into MongoDB.
 // It converts the entity to a BSON document, handling nested structures, slices, maps,
 // and special types (decimal, ObjectID, json.RawMessage).
 // Returns the prepared entity and the BSON document ready for insertion.
+// The BeforeCreate hook, if set, is called with the document (see Hooks), then the resulting entity
+// (the prepared one with the changes of the hook applied) is checked against its validate tags (see Validate)
+// and its references.
 func (p *Processor[T]) PrepareCreate(ctx context.Context, ps T) (prepared T, doc bson.D, err error) {
 	var pr reflect.Value
 	in := reflect.ValueOf(ps)
@@ -118,9 +211,36 @@ func (p *Processor[T]) PrepareCreate(ctx context.Context, ps T) (prepared T, doc
 	if err != nil {
 		return
 	}
+	generated := append(bson.D(nil), doc...)
+	if doc, err = p.beforeCreate(ctx, ps, doc); err != nil {
+		return
+	}
+	created, err := applyCreate[T](pr, generated, doc)
+	if err != nil {
+		return
+	}
+	if err = Validate(created); err != nil {
+		return
+	}
+	if err = p.checkRefs(ctx, created, nil); err != nil {
+		return
+	}
 	return pr.Interface().(T), doc, nil
 }
 
+// applyCreate applies the changes of the BeforeCreate hook to a copy of prepared, so the entity is the one
+// MongoDB would store: the fields of the document which are not generated are set, the generated ones dropped
+// by the hook are cleared (see applyUpdate).
+func applyCreate[T d](prepared reflect.Value, generated, doc bson.D) (created T, err error) {
+	var unset bson.D
+	for _, g := range generated {
+		if !hasKey(doc, g.Key) {
+			unset = append(unset, bson.E{Key: g.Key, Value: ""})
+		}
+	}
+	return applyUpdate(prepared.Interface().(T), prepared, generated, doc, unset)
+}
+
 func (p *Processor[T]) prepareCreate(ctx context.Context, ps reflect.Value) (prepared reflect.Value, doc bson.D, err error) {
 	switch ps.Kind() {
 	case reflect.Ptr:
@@ -451,7 +571,10 @@ func (p *Processor[T]) isEquals(ctx context.Context, _id string, oldData, newDat
 func (p *Processor[T]) setMap(ps reflect.Value) (prepared reflect.Value, doc bson.D, err error) {
 	if !ps.IsNil() {
 		prepared = reflect.MakeMap(ps.Type())
-		for _, key := range ps.MapKeys() {
+		keys := ps.MapKeys()
+		// Sort keys so the generated document does not depend on map iteration order
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
 			value := ps.MapIndex(key)
 			prepared.SetMapIndex(key, value)
 			doc = append(doc, bson.E{Key: key.String(), Value: value.Interface()})
@@ -483,6 +606,8 @@ func (p *Processor[T]) isMapsEqual(ctx context.Context, _id string, oldValue, ne
 // It compares the new entity with the cached version and generates BSON documents
 // for fields that changed (set) and fields that were removed (unset).
 // Returns the prepared entity and the update documents.
+// If there are changes, the BeforeUpdate hook is called with them (see Hooks), then the resulting entity
+// (the cached one with the changes of the hook applied too) is checked against its validate tags (see Validate).
 func (p *Processor[T]) PrepareUpdate(ctx context.Context, ps T) (prepared T, set bson.D, unset bson.D, err error) {
 	var (
 		found bool
@@ -491,11 +616,240 @@ func (p *Processor[T]) PrepareUpdate(ctx context.Context, ps T) (prepared T, set
 		err = ErrNotFound
 		return
 	}
-	pr, s, err := p.prepareUpdate(ctx, ps.ID(), reflect.ValueOf(ps), reflect.ValueOf(prepared))
+	current := prepared
+	pr, set, err := p.prepareUpdate(ctx, ps.ID(), reflect.ValueOf(ps), reflect.ValueOf(prepared))
 	if err != nil {
 		return
 	}
-	return pr.Interface().(T), s, nil, nil
+	if len(set) > 0 {
+		if err = p.checkRefs(ctx, ps, set); err != nil {
+			return
+		}
+		generated := append(bson.D(nil), set...)
+		if set, unset, err = p.beforeUpdate(ctx, current, ps, set, unset); err != nil {
+			return
+		}
+		var updated T
+		if updated, err = applyUpdate(current, pr, generated, set, unset); err != nil {
+			return
+		}
+		if err = Validate(updated); err != nil {
+			return
+		}
+	}
+	return pr.Interface().(T), set, unset, nil
+}
+
+// applyUpdate applies the changes of the BeforeUpdate hook to a copy of prepared (the cached entity with the
+// generated set applied), so the entity is the one MongoDB would store: generated fields dropped by the hook
+// keep their cached value, the entries of set and unset which are not generated are applied.
+// Dotted keys address nested fields, map keys and slice elements; keys of no field of T are ignored.
+func applyUpdate[T d](current T, prepared reflect.Value, generated, set, unset bson.D) (updated T, err error) {
+	v := reflect.New(prepared.Type()).Elem()
+	v.Set(prepared)
+	for _, g := range generated {
+		if hasKey(set, g.Key) {
+			continue
+		}
+		old, found := fieldByBsonKey(reflect.Indirect(reflect.ValueOf(current)), g.Key)
+		if !found {
+			continue
+		}
+		if err = applyPath(v, []string{g.Key}, old.Interface(), false); err != nil {
+			return updated, fmt.Errorf("set %s: %w", g.Key, err)
+		}
+	}
+	for _, e := range set {
+		if containsElement(generated, e) {
+			continue
+		}
+		if err = applyPath(v, strings.Split(e.Key, "."), e.Value, false); err != nil {
+			return updated, fmt.Errorf("set %s: %w", e.Key, err)
+		}
+	}
+	for _, e := range unset {
+		if err = applyPath(v, strings.Split(e.Key, "."), nil, true); err != nil {
+			return updated, fmt.Errorf("unset %s: %w", e.Key, err)
+		}
+	}
+	return v.Interface().(T), nil
+}
+
+func containsElement(doc bson.D, e bson.E) bool {
+	for _, g := range doc {
+		if g.Key == e.Key && reflect.DeepEqual(g.Value, e.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPath sets (or removes) the value at path in v, copying the pointers, maps and slices it walks through.
+func applyPath(v reflect.Value, path []string, value any, remove bool) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() && remove {
+			return nil
+		}
+		c := reflect.New(v.Type().Elem())
+		if !v.IsNil() {
+			c.Elem().Set(v.Elem())
+		}
+		v.Set(c)
+		return applyPath(v.Elem(), path, value, remove)
+	case reflect.Struct:
+		f, found := fieldByBsonKey(v, path[0])
+		if !found {
+			return nil
+		}
+		if len(path) == 1 {
+			return assignValue(f, value, remove)
+		}
+		return applyPath(f, path[1:], value, remove)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || (v.IsNil() && remove) {
+			return nil
+		}
+		c := reflect.MakeMap(v.Type())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), iter.Value())
+		}
+		v.Set(c)
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		if len(path) == 1 && remove {
+			v.SetMapIndex(key, reflect.Value{})
+			return nil
+		}
+		e := reflect.New(v.Type().Elem()).Elem()
+		if cur := v.MapIndex(key); cur.IsValid() {
+			e.Set(cur)
+		}
+		var err error
+		if len(path) == 1 {
+			err = assignValue(e, value, remove)
+		} else {
+			err = applyPath(e, path[1:], value, remove)
+		}
+		if err != nil {
+			return err
+		}
+		v.SetMapIndex(key, e)
+		return nil
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 {
+			return fmt.Errorf("invalid array index %s", path[0])
+		}
+		if remove && i >= v.Len() {
+			return nil
+		}
+		c := reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, v.Len()), v)
+		for c.Len() <= i {
+			c = reflect.Append(c, reflect.Zero(v.Type().Elem()))
+		}
+		v.Set(c)
+		if len(path) == 1 {
+			return assignValue(v.Index(i), value, remove)
+		}
+		return applyPath(v.Index(i), path[1:], value, remove)
+	}
+	return nil
+}
+
+// fieldByBsonKey finds the field of a struct stored under the bson key, in inline and embedded structs too.
+func fieldByBsonKey(v reflect.Value, key string) (f reflect.Value, found bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if !ft.IsExported() {
+			continue
+		}
+		tag := ft.Tag.Get("bson")
+		if name := bsonTagKey(tag); name != "" {
+			if name == key {
+				return v.Field(i), true
+			}
+			if !isBsonInline(tag) {
+				continue
+			}
+		}
+		if ft.Anonymous || isBsonInline(tag) {
+			inner := v.Field(i)
+			if inner.Kind() == reflect.Ptr {
+				if inner.IsNil() {
+					continue
+				}
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				if f, found = fieldByBsonKey(inner, key); found {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// assignValue sets f to a value of an update document, converting it to the type of f.
+func assignValue(f reflect.Value, value any, remove bool) error {
+	if remove || value == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Type().AssignableTo(f.Type()) {
+		f.Set(rv)
+		return nil
+	}
+	if f.Kind() == reflect.Ptr && rv.Type().AssignableTo(f.Type().Elem()) {
+		c := reflect.New(f.Type().Elem())
+		c.Elem().Set(rv)
+		f.Set(c)
+		return nil
+	}
+	if s, ok := value.(string); ok {
+		if u, ok := reflect.New(f.Type()).Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(s)); err != nil {
+				return err
+			}
+			f.Set(reflect.ValueOf(u).Elem())
+			return nil
+		}
+	}
+	if doc, ok := value.(bson.D); ok {
+		t := f.Type()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct || t.Kind() == reflect.Map {
+			c := reflect.New(t).Elem()
+			if t.Kind() == reflect.Map {
+				c.Set(reflect.MakeMap(t))
+			}
+			for _, e := range doc {
+				if err := applyPath(c, []string{e.Key}, e.Value, false); err != nil {
+					return err
+				}
+			}
+			if f.Kind() == reflect.Ptr {
+				c = c.Addr()
+			}
+			f.Set(c)
+			return nil
+		}
+	}
+	b, err := bson.Marshal(bson.D{{Key: "v", Value: value}})
+	if err != nil {
+		return err
+	}
+	c := reflect.New(f.Type())
+	if err = bson.Raw(b).Lookup("v").Unmarshal(c.Interface()); err != nil {
+		return err
+	}
+	f.Set(c.Elem())
+	return nil
 }
 
 func (p *Processor[T]) prepareUpdate(ctx context.Context, _id string, newData, oldData reflect.Value) (prepared reflect.Value, set bson.D, err error) {
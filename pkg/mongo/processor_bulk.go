@@ -0,0 +1,190 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrBulkNotConfigured is returned by the bulk operations of a Processor without a bulk writer.
+var ErrBulkNotConfigured = errors.New("bulk writer is not configured")
+
+type bulkWriter interface {
+	BulkWrite(ctx context.Context, models []mongo.WriteModel) (res *mongo.BulkWriteResult, errs map[int]error, err error)
+	Written(ctx context.Context, versions map[primitive.ObjectID]int64) (written map[primitive.ObjectID]bool, err error)
+}
+
+// SetBulkWriter sets the bulk writer used by CreateMany, UpdateMany and DeleteMany.
+func (p *Processor[T]) SetBulkWriter(bulk bulkWriter) {
+	p.bulk = bulk
+}
+
+// CreateMany inserts the entities with a single unordered bulk write.
+// errs has an element per entity: nil if it was inserted, otherwise its preparation or write error
+// (e.g. a duplicate key). err is returned when the whole batch fails.
+func (p *Processor[T]) CreateMany(ctx context.Context, ps []T) (errs []error, err error) {
+	if p.bulk == nil {
+		return nil, ErrBulkNotConfigured
+	}
+	errs = make([]error, len(ps))
+	var (
+		models []mongo.WriteModel
+		items  []int
+	)
+	version := time.Now().UnixNano()
+	for i, it := range ps {
+		it.SetDeleted(false)
+		_, doc, e := p.PrepareCreate(ctx, it)
+		if e != nil {
+			errs[i] = e
+			continue
+		}
+		if len(doc) == 0 {
+			errs[i] = ErrNothingToCreate
+			continue
+		}
+		models = append(models, mongo.NewInsertOneModel().SetDocument(setVersion(doc, version+int64(i))))
+		items = append(items, i)
+	}
+	_, writeErrs, err := p.bulk.BulkWrite(ctx, models)
+	if err != nil {
+		return
+	}
+	for k, e := range writeErrs {
+		errs[items[k]] = e
+	}
+	return
+}
+
+// UpdateMany applies the changes of the entities with a single unordered bulk write,
+// using optimistic locking on the version of each entity as Update does.
+// errs has an element per entity: nil if it was updated, ErrNothingToUpdate if it has no changes,
+// ErrNotFound if the document does not exist or its version has advanced, otherwise its write error.
+// err is returned when the whole batch fails. Each entity is written with its own version, so the documents
+// which were not matched are the ones without it (a document written again right after the batch is reported too).
+func (p *Processor[T]) UpdateMany(ctx context.Context, ps []T) (errs []error, err error) {
+	if p.bulk == nil {
+		return nil, ErrBulkNotConfigured
+	}
+	errs = make([]error, len(ps))
+	var (
+		models   []mongo.WriteModel
+		items    []int
+		ids      []primitive.ObjectID
+		versions = map[primitive.ObjectID]int64{}
+	)
+	version := time.Now().UnixNano()
+	for i, it := range ps {
+		prepared, set, unset, e := p.PrepareUpdate(ctx, it)
+		if e != nil {
+			errs[i] = e
+			continue
+		}
+		if len(set) == 0 {
+			errs[i] = ErrNothingToUpdate
+			continue
+		}
+		_id, e := primitive.ObjectIDFromHex(prepared.ID())
+		if e != nil {
+			errs[i] = e
+			continue
+		}
+		filter := bson.D{{Key: "_id", Value: _id}}
+		if prepared.Version() != nil {
+			filter = append(filter, bson.E{Key: "version", Value: *prepared.Version()})
+		}
+		update := bson.D{{Key: "$set", Value: setVersion(set, version+int64(i))}}
+		if unset != nil {
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(false))
+		items = append(items, i)
+		ids = append(ids, _id)
+		versions[_id] = version + int64(i)
+	}
+	res, writeErrs, err := p.bulk.BulkWrite(ctx, models)
+	if err != nil {
+		return
+	}
+	for k, e := range writeErrs {
+		errs[items[k]] = e
+	}
+	if int(res.MatchedCount) == len(models)-len(writeErrs) {
+		return
+	}
+	// Some documents were not matched: they are the ones without the version written by this batch.
+	written, err := p.bulk.Written(ctx, versions)
+	if err != nil {
+		return
+	}
+	for k, i := range items {
+		if errs[i] == nil && !written[ids[k]] {
+			errs[i] = ErrNotFound
+		}
+	}
+	return
+}
+
+// DeleteMany deletes the entities with the given IDs with a single unordered bulk write.
+// errs has an element per ID: nil if it was deleted, otherwise its error
+// (ErrNotFound if the entity is not in the cache, when the Processor has one).
+// err is returned when the whole batch fails. Every entity is checked (see PrepareDelete) before the write,
+// and the on-delete policies of the references are applied to the deleted ones after it;
+// an error of them is reported as the error of the entity.
+func (p *Processor[T]) DeleteMany(ctx context.Context, ids []string) (errs []error, err error) {
+	if p.bulk == nil {
+		return nil, ErrBulkNotConfigured
+	}
+	errs = make([]error, len(ids))
+	var (
+		models []mongo.WriteModel
+		items  []int
+	)
+	for i, id := range ids {
+		_id, e := primitive.ObjectIDFromHex(id)
+		if e != nil {
+			errs[i] = e
+			continue
+		}
+		if p.cache != nil {
+			if _, found := p.cache.Get(ctx, id); !found {
+				errs[i] = ErrNotFound
+				continue
+			}
+		}
+		if e = p.PrepareDelete(ctx, id); e != nil {
+			errs[i] = e
+			continue
+		}
+		models = append(models, mongo.NewDeleteOneModel().SetFilter(bson.D{{Key: "_id", Value: _id}}))
+		items = append(items, i)
+	}
+	_, writeErrs, err := p.bulk.BulkWrite(ctx, models)
+	if err != nil {
+		return
+	}
+	for k, e := range writeErrs {
+		errs[items[k]] = e
+	}
+	for _, i := range items {
+		if errs[i] == nil {
+			errs[i] = p.CompleteDelete(ctx, ids[i])
+		}
+	}
+	return
+}
+
+// setVersion sets the version field of the document, as Creator.Create and Updater.UpdateOne do.
+func setVersion(doc bson.D, version int64) bson.D {
+	for k, d := range doc {
+		if d.Key == "version" {
+			doc[k].Value = version
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: "version", Value: version})
+}
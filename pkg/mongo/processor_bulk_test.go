@@ -0,0 +1,118 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mng "go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+// fakeBulk matches every update model except the unmatched ones and fails the models listed in errs.
+type fakeBulk struct {
+	models    []mng.WriteModel
+	unmatched map[int]bool
+	errs      map[int]error
+	versions  map[primitive.ObjectID]int64
+}
+
+func (f *fakeBulk) BulkWrite(ctx context.Context, models []mng.WriteModel) (*mng.BulkWriteResult, map[int]error, error) {
+	f.models = models
+	f.versions = map[primitive.ObjectID]int64{}
+	res := &mng.BulkWriteResult{}
+	for i, m := range models {
+		if f.errs[i] != nil {
+			continue
+		}
+		switch m := m.(type) {
+		case *mng.InsertOneModel:
+			res.InsertedCount++
+		case *mng.UpdateOneModel:
+			if f.unmatched[i] {
+				continue
+			}
+			res.MatchedCount++
+			set := m.Update.(bson.D)[0].Value.(bson.D)
+			f.versions[m.Filter.(bson.D)[0].Value.(primitive.ObjectID)] = set[len(set)-1].Value.(int64)
+		case *mng.DeleteOneModel:
+			res.DeletedCount++
+		}
+	}
+	return res, f.errs, nil
+}
+
+func (f *fakeBulk) Written(ctx context.Context, versions map[primitive.ObjectID]int64) (map[primitive.ObjectID]bool, error) {
+	written := map[primitive.ObjectID]bool{}
+	for id, version := range versions {
+		written[id] = f.versions[id] == version
+	}
+	return written, nil
+}
+
+func TestProcessor_CreateMany(t *testing.T) {
+	p := mongo.NewProcessor[*V](nil, nil, nil, nil)
+	_, err := p.CreateMany(context.Background(), []*V{{}})
+	assert.ErrorIs(t, err, mongo.ErrBulkNotConfigured)
+
+	dup := errors.New("duplicate key")
+	bulk := &fakeBulk{errs: map[int]error{1: dup}}
+	p.SetBulkWriter(bulk)
+	errs, err := p.CreateMany(context.Background(), []*V{{PName: name1}, {PName: name1}, {PName: name1}})
+	assert.NoError(t, err)
+	assert.Len(t, bulk.models, 3)
+	assert.Equal(t, []error{nil, dup, nil}, errs)
+}
+
+func TestProcessor_UpdateMany(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*V](map[string]*V{})
+	a, b, d := &V{D: D{V: &version1}}, &V{D: D{V: &version1}}, &V{D: D{V: &version1}}
+	for _, v := range []*V{a, b, d} {
+		c.Add(ctx, v)
+	}
+	p := mongo.NewProcessor[*V](c, nil, nil, nil)
+	bulk := &fakeBulk{unmatched: map[int]bool{1: true}}
+	p.SetBulkWriter(bulk)
+	errs, err := p.UpdateMany(ctx, []*V{
+		{D: D{Id: a.Id, V: &version1}, PName: name1},
+		{D: D{Id: b.Id, V: &version1}},
+		{D: D{Id: d.Id, V: &version1}, PName: name1},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, bulk.models, 2)
+	assert.Equal(t, []error{nil, mongo.ErrNothingToUpdate, mongo.ErrNotFound}, errs)
+}
+
+func TestProcessor_DeleteMany(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*V](map[string]*V{})
+	a := &V{}
+	c.Add(ctx, a)
+	p := mongo.NewProcessor[*V](c, nil, nil, nil)
+	bulk := &fakeBulk{}
+	p.SetBulkWriter(bulk)
+	errs, err := p.DeleteMany(ctx, []string{a.ID(), primitive.NewObjectID().Hex(), "bad"})
+	assert.NoError(t, err)
+	assert.Len(t, bulk.models, 1)
+	assert.Nil(t, errs[0])
+	assert.ErrorIs(t, errs[1], mongo.ErrNotFound)
+	assert.Error(t, errs[2])
+
+	// every entity is checked before the write; the on-delete policies apply to the deleted ones only
+	b := &V{}
+	c.Add(ctx, b)
+	refs := &fakeRefs{restricted: map[string]bool{"items/" + b.ID(): true}}
+	p.SetReferences("items", refs)
+	errs, err = p.DeleteMany(ctx, []string{a.ID(), b.ID()})
+	assert.NoError(t, err)
+	assert.Nil(t, errs[0])
+	var refErr *mongo.ReferenceError
+	assert.ErrorAs(t, errs[1], &refErr)
+	assert.Equal(t, []string{"items/" + a.ID()}, refs.deleted)
+}
@@ -678,3 +678,49 @@ func TestProcessor_PrepareUpdate_Delete(t *testing.T) {
 		bson.E{Key: "deleted", Value: true},
 	}, set)
 }
+
+type fakeUpdater struct {
+	cond  bson.D
+	found bool
+}
+
+func (f *fakeUpdater) UpdateOne(ctx context.Context, id string, version *int64, set bson.D, unset bson.D) (bool, error) {
+	return f.UpdateOneIf(ctx, id, version, nil, set, unset)
+}
+
+func (f *fakeUpdater) UpdateOneIf(ctx context.Context, id string, version *int64, cond bson.D, set bson.D, unset bson.D) (bool, error) {
+	f.cond = cond
+	return f.found, nil
+}
+
+func (f *fakeUpdater) UpdateOps(ctx context.Context, id string, version *int64, u *mongo.Update) (bool, error) {
+	return f.found, nil
+}
+
+func (f *fakeUpdater) UpdateMany(ctx context.Context, filter interface{}, set bson.D) (int, error) {
+	return 0, nil
+}
+
+func TestProcessor_UpdateIf(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*V](map[string]*V{})
+	u := &fakeUpdater{found: true}
+	p := mongo.NewProcessor[*V](c, nil, u, nil)
+	cond := bson.D{{Key: "pname", Value: name1}}
+
+	_, err := p.UpdateIf(ctx, &V{PName: name1}, cond)
+	assert.ErrorIs(t, err, mongo.ErrNotFound)
+
+	v := &V{D: D{V: &version1}, PName: name1}
+	c.Add(ctx, v)
+	_, err = p.UpdateIf(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: name1}, cond)
+	assert.ErrorIs(t, err, mongo.ErrNothingToUpdate)
+
+	_, err = p.UpdateIf(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: name2}, cond)
+	assert.NoError(t, err)
+	assert.Equal(t, cond, u.cond)
+
+	u.found = false
+	_, err = p.UpdateIf(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: name2}, cond)
+	assert.ErrorIs(t, err, mongo.ErrPreconditionFailed)
+}
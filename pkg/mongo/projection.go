@@ -0,0 +1,107 @@
+package mongo
+
+import (
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PartialEntity is implemented by entities which need to know that they hold only a subset
+// of the document fields (see Projection). SetPartial receives the bson names of the kept fields.
+type PartialEntity interface {
+	SetPartial(fields []string)
+}
+
+// Projection restricts the top-level fields of the documents kept in memory.
+// It is applied to the initial load (options.Find().SetProjection) and to Change Stream events,
+// so fields which are never read from memory (e.g. large blobs) are not cached.
+// The _id, version and deleted fields are always kept.
+type Projection struct {
+	fields []string
+	keep   map[string]struct{}
+}
+
+// NewProjection creates a Projection keeping the given top-level fields (bson names).
+func NewProjection(fields []string) *Projection {
+	p := &Projection{keep: map[string]struct{}{}}
+	for _, f := range append([]string{"_id", "version", "deleted"}, fields...) {
+		f = strings.SplitN(f, ".", 2)[0]
+		if _, ok := p.keep[f]; ok {
+			continue
+		}
+		p.keep[f] = struct{}{}
+		p.fields = append(p.fields, f)
+	}
+	return p
+}
+
+// Fields returns the bson names of the kept fields.
+func (p *Projection) Fields() []string {
+	return p.fields
+}
+
+// Keep reports whether the field (a bson name or a dotted path) is kept by the projection.
+func (p *Projection) Keep(field string) bool {
+	_, ok := p.keep[strings.SplitN(field, ".", 2)[0]]
+	return ok
+}
+
+// Doc returns the projection document for MongoDB find operations.
+func (p *Projection) Doc() bson.D {
+	doc := make(bson.D, 0, len(p.fields))
+	for _, f := range p.fields {
+		doc = append(doc, bson.E{Key: f, Value: 1})
+	}
+	return doc
+}
+
+// Apply clears the fields of v which are not kept by the projection
+// and marks v as partial if it implements PartialEntity.
+func (p *Projection) Apply(v any) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return
+	}
+	p.apply(rv.Elem())
+	if pe, ok := v.(PartialEntity); ok {
+		pe.SetPartial(p.fields)
+	}
+}
+
+func (p *Projection) apply(v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		tag := t.Field(i).Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+		key := bsonTagKey(tag)
+		if key == "" && v.Field(i).Kind() == reflect.Struct {
+			p.apply(v.Field(i))
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(t.Field(i).Name)
+		}
+		if !p.Keep(key) {
+			v.Field(i).Set(reflect.Zero(v.Field(i).Type()))
+		}
+	}
+}
+
+// RemovedFields returns the removed fields of an update event which are kept by the projection.
+func (p *Projection) RemovedFields(removedFields []string) (res []string) {
+	for _, f := range removedFields {
+		if p.Keep(f) {
+			res = append(res, f)
+		}
+	}
+	return
+}
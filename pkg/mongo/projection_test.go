@@ -0,0 +1,44 @@
+package mongo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type Blob struct {
+	D
+	Name    *string `bson:"name"`
+	Content []byte  `bson:"content"`
+	partial []string
+}
+
+func (b *Blob) SetPartial(fields []string) {
+	b.partial = fields
+}
+
+func TestProjection_Apply(t *testing.T) {
+	p := mongo.NewProjection([]string{"name", "meta.size"})
+	assert.Equal(t, []string{"_id", "version", "deleted", "name", "meta"}, p.Fields())
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "version", Value: 1},
+		{Key: "deleted", Value: 1},
+		{Key: "name", Value: 1},
+		{Key: "meta", Value: 1},
+	}, p.Doc())
+
+	id := primitive.NewObjectID()
+	b := &Blob{D: D{Id: id, V: &version1}, Name: &name1, Content: []byte("large")}
+	p.Apply(b)
+	assert.Equal(t, id, b.Id)
+	assert.Equal(t, version1, *b.V)
+	assert.Equal(t, name1, *b.Name)
+	assert.Nil(t, b.Content)
+	assert.Equal(t, p.Fields(), b.partial)
+	assert.Equal(t, []string{"name"}, p.RemovedFields([]string{"content", "name"}))
+}
@@ -0,0 +1,206 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// On-delete policies of a reference (see RefField).
+const (
+	// OnDeleteRestrict rejects the delete of a document which is referenced.
+	OnDeleteRestrict = "restrict"
+	// OnDeleteCascade deletes the referencing documents.
+	OnDeleteCascade = "cascade"
+	// OnDeleteSetNull clears the references: a single reference is set to null, an ID is pulled from a list.
+	OnDeleteSetNull = "setnull"
+)
+
+// RefField is a top-level field which references documents of another collection by their IDs,
+// declared by the ref tag: `ref:"categories"` or `ref:"categories,ondelete=cascade"`.
+// The field is a string or ObjectID (possibly a pointer) or a slice of them.
+type RefField struct {
+	Field      string // bson name
+	Collection string
+	OnDelete   string // empty, OnDeleteRestrict, OnDeleteCascade or OnDeleteSetNull
+	Many       bool   // the field is a slice of IDs
+	ObjectID   bool   // the IDs are stored as ObjectIDs
+	index      int
+}
+
+// Filter returns the filter of the documents which reference the ID.
+func (f RefField) Filter(id string) bson.M {
+	if f.ObjectID {
+		if _id, err := primitive.ObjectIDFromHex(id); err == nil {
+			return bson.M{f.Field: _id}
+		}
+	}
+	return bson.M{f.Field: id}
+}
+
+// ReferenceError is returned for a write which breaks a reference: the referenced document does not exist,
+// or the deleted document is referenced with OnDeleteRestrict.
+type ReferenceError struct {
+	Field      string
+	Collection string
+	ID         string
+	Referenced bool // the error is about a referencing document (delete restricted)
+}
+
+// Error ...
+func (e *ReferenceError) Error() string {
+	if e.Referenced {
+		return fmt.Sprintf("%s %s is referenced by %s", e.Collection, e.ID, e.Field)
+	}
+	return fmt.Sprintf("%s: %s %s does not exist", e.Field, e.Collection, e.ID)
+}
+
+// References resolves the references of entities to other collections (see RefField).
+type References interface {
+	// Exists reports whether the document with the ID exists in the collection.
+	Exists(ctx context.Context, collection, id string) bool
+	// CheckDelete returns an error if the delete of the document is restricted; it does not write.
+	CheckDelete(ctx context.Context, collection, id string) error
+	// OnDelete applies the on-delete policies of the references to the document, once it is deleted.
+	OnDelete(ctx context.Context, collection, id string) error
+}
+
+var refFields sync.Map // map[reflect.Type][]RefField
+
+// RefFields returns the reference fields declared by the ref tags of the entity type.
+func RefFields(t reflect.Type) (fields []RefField, err error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if cached, ok := refFields.Load(t); ok {
+		return cached.([]RefField), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		tag, ok := ft.Tag.Lookup("ref")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := RefField{
+			Field:      strings.Split(ft.Tag.Get("bson"), ",")[0],
+			Collection: parts[0],
+			index:      i,
+		}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "ondelete=" + OnDeleteRestrict, "ondelete=" + OnDeleteCascade, "ondelete=" + OnDeleteSetNull:
+				f.OnDelete = strings.TrimPrefix(opt, "ondelete=")
+			default:
+				return nil, fmt.Errorf("ref tag of %s: unknown option %s", ft.Name, opt)
+			}
+		}
+		et := ft.Type
+		if et.Kind() == reflect.Slice {
+			f.Many = true
+			et = et.Elem()
+		}
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		switch {
+		case et == reflect.TypeOf(primitive.ObjectID{}):
+			f.ObjectID = true
+		case et.Kind() == reflect.String:
+		default:
+			return nil, fmt.Errorf("ref tag of %s: unsupported type %s", ft.Name, ft.Type)
+		}
+		if f.Field == "" || f.Collection == "" {
+			return nil, fmt.Errorf("ref tag of %s: bson name and collection are required", ft.Name)
+		}
+		fields = append(fields, f)
+	}
+	refFields.Store(t, fields)
+	return
+}
+
+// ids returns the IDs referenced by the field of the entity.
+func (f RefField) ids(v reflect.Value) (ids []string) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	fv := v.Field(f.index)
+	if !f.Many {
+		return refID(fv)
+	}
+	for i := 0; i < fv.Len(); i++ {
+		ids = append(ids, refID(fv.Index(i))...)
+	}
+	return
+}
+
+func refID(v reflect.Value) []string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if id, ok := v.Interface().(primitive.ObjectID); ok {
+		if id.IsZero() {
+			return nil
+		}
+		return []string{id.Hex()}
+	}
+	if v.String() == "" {
+		return nil
+	}
+	return []string{v.String()}
+}
+
+// SetReferences sets the resolver of the references of the entities, which are stored in the collection.
+// With references, PrepareCreate and PrepareUpdate check that the referenced documents exist
+// and the on-delete policies of the references to the deleted document are checked by PrepareDelete
+// and applied by CompleteDelete.
+func (p *Processor[T]) SetReferences(collection string, refs References) {
+	p.collection = collection
+	p.refs = refs
+}
+
+// checkRefs checks the references of the entity; with changed set, only the references of the changed fields.
+func (p *Processor[T]) checkRefs(ctx context.Context, ps T, changed bson.D) (err error) {
+	if p.refs == nil {
+		return
+	}
+	fields, err := RefFields(reflect.TypeOf(ps))
+	if err != nil {
+		return
+	}
+	v := reflect.ValueOf(ps)
+	for _, f := range fields {
+		if changed != nil && !hasKey(changed, f.Field) {
+			continue
+		}
+		for _, id := range f.ids(v) {
+			if !p.refs.Exists(ctx, f.Collection, id) {
+				return &ReferenceError{Field: f.Field, Collection: f.Collection, ID: id}
+			}
+		}
+	}
+	return
+}
+
+func hasKey(doc bson.D, key string) bool {
+	for _, e := range doc {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package mongo_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type Post struct {
+	D
+	Title    string               `bson:"title"`
+	Category *string              `bson:"category" ref:"categories,ondelete=cascade"`
+	Tags     []primitive.ObjectID `bson:"tags" ref:"tags,ondelete=setnull"`
+}
+
+type fakeRefs struct {
+	existing   map[string]bool
+	restricted map[string]bool
+	deleted    []string
+}
+
+func (f *fakeRefs) Exists(ctx context.Context, collection, id string) bool {
+	return f.existing[collection+"/"+id]
+}
+
+func (f *fakeRefs) CheckDelete(ctx context.Context, collection, id string) error {
+	if f.restricted[collection+"/"+id] {
+		return &mongo.ReferenceError{Collection: collection, ID: id, Referenced: true}
+	}
+	return nil
+}
+
+func (f *fakeRefs) OnDelete(ctx context.Context, collection, id string) error {
+	f.deleted = append(f.deleted, collection+"/"+id)
+	return nil
+}
+
+func TestRefFields(t *testing.T) {
+	fields, err := mongo.RefFields(reflect.TypeOf(&Post{}))
+	assert.NoError(t, err)
+	assert.Len(t, fields, 2)
+	assert.Equal(t, "category", fields[0].Field)
+	assert.Equal(t, "categories", fields[0].Collection)
+	assert.Equal(t, mongo.OnDeleteCascade, fields[0].OnDelete)
+	assert.False(t, fields[0].Many)
+	assert.Equal(t, "tags", fields[1].Field)
+	assert.True(t, fields[1].Many)
+	assert.True(t, fields[1].ObjectID)
+
+	tag := primitive.NewObjectID()
+	assert.Equal(t, tag, fields[1].Filter(tag.Hex())["tags"])
+	assert.Equal(t, "c1", fields[0].Filter("c1")["category"])
+}
+
+func TestProcessor_References(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*Post](map[string]*Post{})
+	p := mongo.NewProcessor[*Post](c, nil, nil, nil)
+	tag := primitive.NewObjectID()
+	refs := &fakeRefs{existing: map[string]bool{"categories/c1": true, "tags/" + tag.Hex(): true}}
+	p.SetReferences("posts", refs)
+
+	c1, c2 := "c1", "c2"
+	_, _, err := p.PrepareCreate(ctx, &Post{Category: &c1, Tags: []primitive.ObjectID{tag}})
+	assert.NoError(t, err)
+	_, _, err = p.PrepareCreate(ctx, &Post{Category: &c2})
+	var refErr *mongo.ReferenceError
+	assert.ErrorAs(t, err, &refErr)
+	assert.Equal(t, mongo.ReferenceError{Field: "category", Collection: "categories", ID: c2}, *refErr)
+	_, _, err = p.PrepareCreate(ctx, &Post{Tags: []primitive.ObjectID{primitive.NewObjectID()}})
+	assert.ErrorAs(t, err, &refErr)
+
+	// an update checks only the changed references
+	delete(refs.existing, "categories/c1")
+	v := &Post{D: D{V: &version1}, Category: &c1}
+	c.Add(ctx, v)
+	_, _, _, err = p.PrepareUpdate(ctx, &Post{D: D{Id: v.Id, V: &version1}, Category: &c1, Title: name1})
+	assert.NoError(t, err)
+	_, _, _, err = p.PrepareUpdate(ctx, &Post{D: D{Id: v.Id, V: &version1}, Category: &c2})
+	assert.ErrorAs(t, err, &refErr)
+
+	// a delete is checked without writing, the on-delete policies are applied once it is deleted
+	assert.NoError(t, p.PrepareDelete(ctx, v.ID()))
+	assert.Empty(t, refs.deleted)
+	assert.NoError(t, p.CompleteDelete(ctx, v.ID()))
+	assert.Equal(t, []string{"posts/" + v.ID()}, refs.deleted)
+	refs.restricted = map[string]bool{"posts/" + v.ID(): true}
+	assert.ErrorAs(t, p.PrepareDelete(ctx, v.ID()), &refErr)
+}
@@ -18,12 +18,42 @@ type Searcher[T d] struct {
 	db                string
 	collection        string
 	connectionTimeout time.Duration
+	projection        *Projection
 }
 
 func findOpts() *options.FindOptions {
 	return options.Find().SetBatchSize(2000)
 }
 
+// SetProjection restricts the fields of the found documents (nil means full documents).
+// Found entities are marked as partial if they implement PartialEntity.
+func (s *Searcher[T]) SetProjection(projection *Projection) {
+	s.projection = projection
+}
+
+func (s *Searcher[T]) findOpts() *options.FindOptions {
+	opts := findOpts()
+	if s.projection != nil {
+		opts.SetProjection(s.projection.Doc())
+	}
+	return opts
+}
+
+func (s *Searcher[T]) findOneOpts() *options.FindOneOptions {
+	opts := options.FindOne()
+	if s.projection != nil {
+		opts.SetProjection(s.projection.Doc())
+	}
+	return opts
+}
+
+func (s *Searcher[T]) partial(instance T) T {
+	if s.projection != nil {
+		s.projection.Apply(instance)
+	}
+	return instance
+}
+
 // decodeCursorDoc decodes a cursor document into T. Pointer-to-struct entities (common in this codebase)
 // use bson.Unmarshal directly; the legacy JSON path is kept as a fallback for unusual types.
 func decodeCursorDoc[T d](cur *mongo.Cursor) (instance T, err error) {
@@ -83,7 +113,7 @@ func (s *Searcher[T]) All(ctx context.Context) (items []T, err error) {
 	collection := s.client.Database(s.db).Collection(s.collection)
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
-	cur, e := collection.Find(ctx, bson.M{}, findOpts())
+	cur, e := collection.Find(ctx, bson.M{}, s.findOpts())
 	if e != nil {
 		return nil, e
 	}
@@ -96,7 +126,7 @@ func (s *Searcher[T]) All(ctx context.Context) (items []T, err error) {
 		if err != nil {
 			continue
 		}
-		items = append(items, instance)
+		items = append(items, s.partial(instance))
 	}
 	if err = cur.Err(); err != nil {
 		return
@@ -111,7 +141,7 @@ func (s *Searcher[T]) Find(ctx context.Context, filter map[string]interface{}) (
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
 	bsonFilter := bson.M(filter)
-	cur, e := collection.Find(ctx, bsonFilter, findOpts())
+	cur, e := collection.Find(ctx, bsonFilter, s.findOpts())
 	if e != nil {
 		return nil, e
 	}
@@ -124,7 +154,7 @@ func (s *Searcher[T]) Find(ctx context.Context, filter map[string]interface{}) (
 		if err != nil {
 			continue
 		}
-		items = append(items, instance)
+		items = append(items, s.partial(instance))
 	}
 	if err = cur.Err(); err != nil {
 		return
@@ -141,7 +171,7 @@ func (s *Searcher[T]) FindOne(ctx context.Context, filter map[string]interface{}
 	defer cancel()
 	bsonFilter := bson.M(filter)
 	var raw bson.Raw
-	err = collection.FindOne(ctx, bsonFilter).Decode(&raw)
+	err = collection.FindOne(ctx, bsonFilter, s.findOneOpts()).Decode(&raw)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return item, false, nil
@@ -152,7 +182,7 @@ func (s *Searcher[T]) FindOne(ctx context.Context, filter map[string]interface{}
 	if err != nil {
 		return item, false, err
 	}
-	return instance, true, nil
+	return s.partial(instance), true, nil
 }
 
 // FindWithFilter retrieves documents matching the provided BSON filter.
@@ -161,7 +191,7 @@ func (s *Searcher[T]) FindWithFilter(ctx context.Context, filter bson.M) (items
 	collection := s.client.Database(s.db).Collection(s.collection)
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
-	cur, e := collection.Find(ctx, filter, findOpts())
+	cur, e := collection.Find(ctx, filter, s.findOpts())
 	if e != nil {
 		return nil, e
 	}
@@ -174,7 +204,7 @@ func (s *Searcher[T]) FindWithFilter(ctx context.Context, filter bson.M) (items
 		if err != nil {
 			continue
 		}
-		items = append(items, instance)
+		items = append(items, s.partial(instance))
 	}
 	if err = cur.Err(); err != nil {
 		return
@@ -190,7 +220,7 @@ func (s *Searcher[T]) FindOneWithFilter(ctx context.Context, filter bson.M) (ite
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
 	var raw bson.Raw
-	err = collection.FindOne(ctx, filter).Decode(&raw)
+	err = collection.FindOne(ctx, filter, s.findOneOpts()).Decode(&raw)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return item, false, nil
@@ -201,7 +231,7 @@ func (s *Searcher[T]) FindOneWithFilter(ctx context.Context, filter bson.M) (ite
 	if err != nil {
 		return item, false, err
 	}
-	return instance, true, nil
+	return s.partial(instance), true, nil
 }
 
 // NewSearcher creates a new Searcher instance for a typed entity.
@@ -5,11 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"sort"
 	"sync"
 
 	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -21,75 +25,340 @@ var (
 // and processes Change Stream events to keep the in-memory projection synchronized.
 type Stream struct {
 	sync.RWMutex
-	change    *mongo.ChangeStream
-	listeners map[string]map[string]StreamListener // listeners by db and collection
+	change     *mongo.ChangeStream
+	listeners  map[string]map[string][]streamRegistration // listeners by db and collection
+	watcher    Watcher
+	client     *mongo.Client
+	scope      string
+	opts       []*options.ChangeStreamOptions
+	generation uint64        // incremented when listeners change, so owned Change Streams are reopened
+	changed    chan struct{} // closed and replaced when listeners change
+	deadLetter DeadLetterSink
+	workers    StreamWorkers
+}
+
+// Watcher opens MongoDB Change Streams. *mongo.Client, *mongo.Database and *mongo.Collection implement it.
+type Watcher interface {
+	Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+}
+
+// StreamFilter narrows the Change Stream events of a namespace on the server side.
+// OperationTypes restricts the operation types of the insert, update and replace events (empty means all of them).
+// Match adds conditions on the fields of these events, e.g. bson.D{{Key: "fullDocument.status", Value: "open"}}.
+// Delete, drop and rename events are never filtered, so the projection still evicts deleted documents
+// and is cleared when the collection is dropped or renamed.
+// Unset lists top-level document fields which are never cached (e.g. large blobs);
+// they are removed from fullDocument and updateDescription.updatedFields (requires MongoDB 5.0+).
+type StreamFilter struct {
+	OperationTypes []string
+	Match          bson.D
+	Unset          []string
 }
 
 func (s *Stream) SetChange(change *mongo.ChangeStream) {
 	s.change = change
 }
 
+// SetWatcher makes the Stream open its Change Stream itself with a pipeline built from the registered listeners
+// (see Pipeline), so that events of namespaces without a listener are filtered out by MongoDB.
+// The Change Stream is reopened, resuming after the last processed event, whenever listeners change.
+func (s *Stream) SetWatcher(watcher Watcher, opts ...*options.ChangeStreamOptions) {
+	s.Lock()
+	defer s.Unlock()
+	s.watcher = watcher
+	s.opts = opts
+	s.generation++
+}
+
+// streamRegistration is a listener of a namespace with its filter.
+type streamRegistration struct {
+	listener StreamListener
+	filter   StreamFilter
+}
+
 // AddListener registers a listener for Change Stream events from a specific database and collection.
 // The listener will be called for each Change Stream event from the specified collection.
+// Several listeners may be registered for a namespace: each event is dispatched to all of them,
+// in the order of registration. Registering a listener again replaces its filter.
 func (s *Stream) AddListener(ctx context.Context, db, col string, listener StreamListener) {
+	s.AddListenerWithFilter(ctx, db, col, listener, StreamFilter{})
+}
+
+// AddListenerWithFilter registers a listener like AddListener and narrows the events of its namespace
+// with a server-side filter. The filter is only applied when the Stream owns its Change Stream (see SetWatcher),
+// except its operation types which are also checked before the listener is called.
+// The server-side filter of a namespace with several listeners is the union of their filters, so a listener
+// may receive events matching only the Match conditions of another listener of its namespace.
+func (s *Stream) AddListenerWithFilter(ctx context.Context, db, col string, listener StreamListener, filter StreamFilter) {
 	s.Lock()
 	defer s.Unlock()
 	if _, ok := s.listeners[db]; !ok {
-		s.listeners[db] = map[string]StreamListener{}
+		s.listeners[db] = map[string][]streamRegistration{}
+	}
+	s.notify()
+	regs := s.listeners[db][col]
+	if i := indexOfListener(regs, listener); i >= 0 {
+		regs[i].filter = filter
+		return
 	}
-	s.listeners[db][col] = listener
+	s.listeners[db][col] = append(regs, streamRegistration{listener: listener, filter: filter})
 }
 
-// Listen starts processing Change Stream events and routing them to registered listeners.
-// This method blocks until the Change Stream is closed or an error occurs.
-// It automatically closes the Change Stream when it returns.
-func (s *Stream) Listen(ctx context.Context) (err error) {
+// RemoveListener unregisters a listener of a namespace; it is no longer called once RemoveListener returns,
+// except for an event being dispatched. It reports whether the listener was registered.
+func (s *Stream) RemoveListener(ctx context.Context, db, col string, listener StreamListener) (removed bool) {
+	s.Lock()
+	defer s.Unlock()
+	regs := s.listeners[db][col]
+	i := indexOfListener(regs, listener)
+	if i < 0 {
+		return false
+	}
+	regs = append(regs[:i:i], regs[i+1:]...)
+	if len(regs) > 0 {
+		s.listeners[db][col] = regs
+	} else {
+		delete(s.listeners[db], col)
+		if len(s.listeners[db]) == 0 {
+			delete(s.listeners, db)
+		}
+	}
+	s.notify()
+	return true
+}
+
+// notify signals a change of the listeners. It must be called with the lock held.
+func (s *Stream) notify() {
+	s.generation++
+	if s.changed != nil {
+		close(s.changed)
+	}
+	s.changed = make(chan struct{})
+}
+
+// indexOfListener returns the index of the registration of the listener, compared with ==, or -1.
+func indexOfListener(regs []streamRegistration, listener StreamListener) int {
+	if listener == nil || !reflect.TypeOf(listener).Comparable() {
+		return -1
+	}
+	for i, r := range regs {
+		if reflect.TypeOf(r.listener) == reflect.TypeOf(listener) && r.listener == listener {
+			return i
+		}
+	}
+	return -1
+}
+
+// Pipeline builds the Change Stream pipeline for the registered listeners:
+// a $match on namespaces, operation types and field conditions,
+// followed by a $set stage removing the unset fields of each namespace.
+func (s *Stream) Pipeline() mongo.Pipeline {
+	return s.pipeline("")
+}
+
+// pipeline builds the pipeline for the listeners of the database, or of every database if db is empty.
+func (s *Stream) pipeline(db string) mongo.Pipeline {
+	s.RLock()
+	defer s.RUnlock()
+	dbs := sortedKeys(s.listeners)
+	if db != "" {
+		dbs = []string{db}
+	}
+	or := bson.A{bson.D{{Key: "operationType", Value: InvalidateOperationType}}}
 	var (
-		p  map[string]StreamListener
-		k  StreamListener
-		ok bool
+		fullDocument  interface{} = "$fullDocument"
+		updatedFields interface{} = "$updateDescription.updatedFields"
+		unset         bool
 	)
-	logger := zerolog.Ctx(ctx)
-	defer s.change.Close(ctx)
-	for {
-		if s.change.TryNext(ctx) {
-			// A new event variable should be declared for each event.
-			var tp StreamingNS
-			if e := s.change.Decode(&tp); e != nil {
-				logWithError(logger, s.change.Current, e, "error while decoding ns from stream")
-				continue
-			}
-			s.RLock()
-			if p, ok = s.listeners[tp.NS.Db]; !ok {
-				s.RUnlock()
-				continue
+	for _, db := range dbs {
+		or = append(or, bson.D{
+			{Key: "operationType", Value: DropDatabaseOperationType},
+			{Key: "ns.db", Value: db},
+		})
+		for _, col := range sortedKeys(s.listeners[db]) {
+			regs := s.listeners[db][col]
+			match := bson.D{
+				{Key: "ns.db", Value: db},
+				{Key: "ns.coll", Value: col},
 			}
-			if k, ok = p[tp.NS.Coll]; !ok {
-				s.RUnlock()
-				continue
+			// Several listeners receive the union of their filters.
+			union := bson.A{bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: unfilteredOperationTypes}}}}}
+			for _, r := range regs {
+				cond := r.filter.conditions()
+				if len(cond) == 0 {
+					union = nil
+					break
+				}
+				union = append(union, cond)
 			}
-			s.RUnlock()
-			var bsonDocument bson.D
-			var temporaryBytes []byte
-			err = s.change.Decode(&bsonDocument)
-			temporaryBytes, err = bson.MarshalExtJSON(bsonDocument, false, false)
-			if err != nil {
-				logger.Err(err).Msg("processing stream: unmarshal from bson to json")
-				continue
+			if len(union) > 0 {
+				match = append(match, bson.E{Key: "$or", Value: union})
 			}
-			err = k.Listen(ctx, temporaryBytes)
-			if err != nil {
-				logger.Err(err).Msg("processing stream")
-				continue
+			or = append(or, match)
+			if fields := unsetByAll(regs); len(fields) > 0 {
+				unset = true
+				fullDocument = unsetFields(db, col, "$fullDocument", fullDocument, fields)
+				updatedFields = unsetFields(db, col, "$updateDescription.updatedFields", updatedFields, fields)
 			}
 		}
+	}
+	pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: or}}}}}
+	if unset {
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "fullDocument", Value: fullDocument},
+			{Key: "updateDescription.updatedFields", Value: updatedFields},
+		}}})
+	}
+	return pipeline
+}
+
+// unfilteredOperationTypes are the operation types of the events which a StreamFilter lets through.
+var unfilteredOperationTypes = []string{DeleteOperationType, DropOperationType, RenameOperationType}
+
+// conditions returns the conditions of the filter on the insert, update and replace events of its namespace.
+func (f StreamFilter) conditions() (match bson.D) {
+	if len(f.OperationTypes) > 0 {
+		match = append(match, bson.E{Key: "operationType", Value: bson.D{{Key: "$in", Value: f.OperationTypes}}})
+	}
+	return append(match, f.Match...)
+}
+
+// accepts reports whether the operation type of an event of its namespace passes the filter.
+func (f StreamFilter) accepts(operationType string) bool {
+	return len(f.OperationTypes) == 0 || slices.Contains(f.OperationTypes, operationType) ||
+		slices.Contains(unfilteredOperationTypes, operationType)
+}
+
+// unsetByAll returns the fields unset by the filters of all the listeners, since the others need them.
+func unsetByAll(regs []streamRegistration) (fields []string) {
+	for _, f := range regs[0].filter.Unset {
+		all := true
+		for _, r := range regs[1:] {
+			all = all && slices.Contains(r.filter.Unset, f)
+		}
+		if all {
+			fields = append(fields, f)
+		}
+	}
+	return
+}
+
+func sortedKeys[V any](m map[string]V) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// unsetFields wraps expr so that, for events of the db.col namespace, the fields are removed from the document at path.
+func unsetFields(db, col, path string, expr interface{}, fields []string) interface{} {
+	var input interface{} = path
+	for _, f := range fields {
+		input = bson.D{{Key: "$unsetField", Value: bson.D{
+			{Key: "field", Value: f},
+			{Key: "input", Value: input},
+		}}}
+	}
+	return bson.D{{Key: "$cond", Value: bson.A{
+		bson.D{{Key: "$and", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{"$ns.db", db}}},
+			bson.D{{Key: "$eq", Value: bson.A{"$ns.coll", col}}},
+			bson.D{{Key: "$eq", Value: bson.A{bson.D{{Key: "$type", Value: path}}, "object"}}},
+		}}},
+		input,
+		expr,
+	}}}
+}
+
+// watchedStream is a Change Stream of the Stream with the events of a database, or of every database if db is empty.
+type watchedStream struct {
+	db         string
+	watcher    Watcher // nil if the Change Stream is not owned by the Stream
+	change     *mongo.ChangeStream
+	generation uint64
+}
+
+// open (re)opens the Change Stream with the current pipeline if the Stream owns it and listeners changed.
+// A reopened Change Stream resumes after the last event of the previous one.
+func (s *Stream) open(ctx context.Context, w *watchedStream) (err error) {
+	s.RLock()
+	generation := s.generation
+	opts := options.MergeChangeStreamOptions(s.opts...)
+	s.RUnlock()
+	if w.watcher == nil || w.change != nil && w.generation == generation {
+		return
+	}
+	w.generation = generation
+	if w.change != nil {
+		if token := w.change.ResumeToken(); token != nil {
+			opts.StartAfter = nil
+			opts.StartAtOperationTime = nil
+			opts.SetResumeAfter(token)
+		}
+		_ = w.change.Close(ctx)
+	}
+	w.change, err = w.watcher.Watch(ctx, s.pipeline(w.db), opts)
+	return
+}
+
+// Listen starts processing Change Stream events and routing them to registered listeners.
+// This method blocks until the Change Stream is closed or an error occurs.
+// It automatically closes the Change Stream when it returns.
+// An event whose dispatch fails or panics is logged and quarantined (see SetDeadLetter), and processing continues.
+// Events are dispatched on the Listen goroutine, or by parallel workers (see SetWorkers).
+// A Stream with a client opens and listens to its own Change Streams (see SetClient).
+func (s *Stream) Listen(ctx context.Context) (err error) {
+	s.RLock()
+	client, scope := s.client, s.scope
+	w := &watchedStream{watcher: s.watcher, change: s.change, generation: s.generation}
+	s.RUnlock()
+	if client != nil {
+		return s.listenClient(ctx, client, scope)
+	}
+	if w.watcher != nil && w.change != nil {
+		// The Change Stream set by SetChange is reopened with the pipeline, resuming after its last event.
+		w.generation--
+	}
+	return s.listen(ctx, w)
+}
+
+// listen processes the events of a Change Stream until it is closed or an error occurs.
+func (s *Stream) listen(ctx context.Context, w *watchedStream) (err error) {
+	logger := zerolog.Ctx(ctx)
+	submit := func(ctx context.Context, event bson.Raw) {
+		s.process(ctx, w.db, event)
+	}
+	if err = s.open(ctx, w); err != nil {
+		logger.Err(err).Msg("open change stream")
+		return
+	}
+	defer func() {
+		_ = w.change.Close(ctx)
+	}()
+	s.RLock()
+	workers := s.workers
+	s.RUnlock()
+	if workers.Workers > 1 {
+		pool := newWorkerPool(ctx, s, w.db, workers)
+		defer pool.close()
+		submit = pool.submit
+	}
+	for {
+		if err = s.open(ctx, w); err != nil {
+			logger.Err(err).Msg("reopen change stream")
+			return
+		}
+		if w.change.TryNext(ctx) {
+			submit(ctx, w.change.Current)
+		}
 		// If TryNext returns false, the next change is not yet available, the change stream was closed by the server,
 		// or an error occurred. TryNext should only be called again for the empty batch case.
-		if err = s.change.Err(); err != nil {
+		if err = w.change.Err(); err != nil {
 			logger.Err(err).Msg("change error")
 			return
 		}
-		if s.change.ID() == 0 {
+		if w.change.ID() == 0 {
 			err = errStreamFailed
 			logger.Err(err).Msg("streaming failed")
 			return
@@ -97,14 +366,102 @@ func (s *Stream) Listen(ctx context.Context) (err error) {
 	}
 }
 
+// dispatch routes a raw Change Stream event of a Change Stream of the database (every database if db is empty)
+// to its listeners. Panics of the decoding and of each listener are recovered and returned as errors,
+// so a poison event does not stop the Stream.
+func (s *Stream) dispatch(ctx context.Context, db string, event bson.Raw) (err error) {
+	defer recoverDispatch(ctx, &err)
+	// A new event variable should be declared for each event.
+	var tp StreamingNS
+	if err = bson.Unmarshal(event, &tp); err != nil {
+		return fmt.Errorf("decode ns: %w", err)
+	}
+	targets := s.targets(db, tp)
+	if len(targets) == 0 {
+		return
+	}
+	var bsonDocument bson.D
+	if err = bson.Unmarshal(event, &bsonDocument); err != nil {
+		return fmt.Errorf("decode event: %w", err)
+	}
+	temporaryBytes, err := bson.MarshalExtJSON(bsonDocument, false, false)
+	if err != nil {
+		return fmt.Errorf("unmarshal from bson to json: %w", err)
+	}
+	var errs []error
+	for _, k := range targets {
+		errs = append(errs, listen(ctx, k, temporaryBytes))
+	}
+	return errors.Join(errs...)
+}
+
+// listen calls a listener, recovering its panic, so the other listeners of the event are still called.
+func listen(ctx context.Context, listener StreamListener, event []byte) (err error) {
+	defer recoverDispatch(ctx, &err)
+	return listener.Listen(ctx, event)
+}
+
+// jsonEvent returns the relaxed extended JSON of an event for logging.
+func jsonEvent(event bson.Raw) []byte {
+	b, err := bson.MarshalExtJSON(event, false, false)
+	if err != nil {
+		return []byte(event.String())
+	}
+	return b
+}
+
+// targets returns the listeners of an event of a Change Stream of the database (every database if db is empty):
+// the listeners of its namespace, every listener of the database for dropDatabase events
+// and every listener of the Change Stream for invalidate events.
+func (s *Stream) targets(db string, tp StreamingNS) (targets []StreamListener) {
+	s.RLock()
+	defer s.RUnlock()
+	switch tp.OperationType {
+	case InvalidateOperationType:
+		dbs := sortedKeys(s.listeners)
+		if db != "" {
+			dbs = []string{db}
+		}
+		for _, db := range dbs {
+			for _, col := range sortedKeys(s.listeners[db]) {
+				for _, r := range s.listeners[db][col] {
+					targets = append(targets, r.listener)
+				}
+			}
+		}
+	case DropDatabaseOperationType:
+		for _, col := range sortedKeys(s.listeners[tp.NS.Db]) {
+			for _, r := range s.listeners[tp.NS.Db][col] {
+				targets = append(targets, r.listener)
+			}
+		}
+	default:
+		for _, r := range s.listeners[tp.NS.Db][tp.NS.Coll] {
+			if r.filter.accepts(tp.OperationType) {
+				targets = append(targets, r.listener)
+			}
+		}
+	}
+	return
+}
+
 // NewStream creates a new Stream instance with the provided Change Stream and listeners map.
+// The Change Stream may be nil if the Stream opens it itself (see SetWatcher).
 func NewStream(
 	change *mongo.ChangeStream,
 	listeners map[string]map[string]StreamListener,
 ) *Stream {
+	regs := map[string]map[string][]streamRegistration{}
+	for db, cols := range listeners {
+		regs[db] = map[string][]streamRegistration{}
+		for col, listener := range cols {
+			regs[db][col] = []streamRegistration{{listener: listener}}
+		}
+	}
 	return &Stream{
 		change:    change,
-		listeners: listeners,
+		listeners: regs,
+		changed:   make(chan struct{}),
 	}
 }
 
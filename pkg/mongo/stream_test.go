@@ -0,0 +1,114 @@
+package mongo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type nopStreamListener struct{}
+
+func (nopStreamListener) Listen(ctx context.Context, change []byte) (err error) {
+	return
+}
+
+func TestStream_Pipeline(t *testing.T) {
+	s := mongo.NewStream(nil, map[string]map[string]mongo.StreamListener{})
+	s.AddListenerWithFilter(context.Background(), "db", "files", nopStreamListener{}, mongo.StreamFilter{
+		OperationTypes: []string{mongo.InsertOperationType, mongo.UpdateOperationType},
+		Match:          bson.D{{Key: "fullDocument.public", Value: true}},
+	})
+	pipeline := s.Pipeline()
+	assert.Len(t, pipeline, 1)
+	assert.Equal(t, bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "operationType", Value: mongo.InvalidateOperationType}},
+		bson.D{
+			{Key: "operationType", Value: mongo.DropDatabaseOperationType},
+			{Key: "ns.db", Value: "db"},
+		},
+		bson.D{
+			{Key: "ns.db", Value: "db"},
+			{Key: "ns.coll", Value: "files"},
+			// Delete, drop and rename events are not filtered.
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: []string{
+					mongo.DeleteOperationType, mongo.DropOperationType, mongo.RenameOperationType,
+				}}}}},
+				bson.D{
+					{Key: "operationType", Value: bson.D{{Key: "$in", Value: []string{mongo.InsertOperationType, mongo.UpdateOperationType}}}},
+					{Key: "fullDocument.public", Value: true},
+				},
+			}},
+		},
+	}}}}}, pipeline[0])
+
+	s.AddListenerWithFilter(context.Background(), "db", "files", nopStreamListener{}, mongo.StreamFilter{
+		Unset: []string{"content"},
+	})
+	pipeline = s.Pipeline()
+	assert.Len(t, pipeline, 2)
+	set := pipeline[1][0].Value.(bson.D)
+	assert.Equal(t, "fullDocument", set[0].Key)
+	assert.Equal(t, "updateDescription.updatedFields", set[1].Key)
+	_, err := bson.Marshal(pipeline[1])
+	assert.NoError(t, err)
+}
+
+type countingListener struct {
+	events int
+}
+
+func (l *countingListener) Listen(ctx context.Context, change []byte) (err error) {
+	l.events++
+	return
+}
+
+func TestStream_MultipleListeners(t *testing.T) {
+	ctx := context.Background()
+	s := mongo.NewStream(nil, map[string]map[string]mongo.StreamListener{})
+	ring := mongo.NewDeadLetterRing(10)
+	s.SetDeadLetter(ring)
+	all, inserts := &countingListener{}, &countingListener{}
+	s.AddListener(ctx, "db", "files", all)
+	s.AddListenerWithFilter(ctx, "db", "files", inserts, mongo.StreamFilter{
+		OperationTypes: []string{mongo.InsertOperationType},
+		Match:          bson.D{{Key: "fullDocument.public", Value: true}},
+	})
+
+	// A listener without a filter receives every event of the namespace.
+	match := s.Pipeline()[0][0].Value.(bson.D)[0].Value.(bson.A)
+	assert.Equal(t, bson.D{{Key: "ns.db", Value: "db"}, {Key: "ns.coll", Value: "files"}}, match[2])
+
+	replay := func(op string) {
+		event, err := bson.Marshal(bson.D{
+			{Key: "operationType", Value: op},
+			{Key: "ns", Value: bson.D{{Key: "db", Value: "db"}, {Key: "coll", Value: "files"}}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, ring.Put(ctx, mongo.DeadLetter{ID: op, Event: event}))
+		require.NoError(t, s.Replay(ctx, op))
+	}
+	replay(mongo.InsertOperationType)
+	replay(mongo.UpdateOperationType)
+	assert.Equal(t, 2, all.events)
+	assert.Equal(t, 1, inserts.events)
+	// Delete and drop events reach filtered listeners.
+	replay(mongo.DeleteOperationType)
+	replay(mongo.DropOperationType)
+	assert.Equal(t, 4, all.events)
+	assert.Equal(t, 3, inserts.events)
+
+	assert.True(t, s.RemoveListener(ctx, "db", "files", all))
+	assert.False(t, s.RemoveListener(ctx, "db", "files", all))
+	replay(mongo.InsertOperationType)
+	assert.Equal(t, 4, all.events)
+	assert.Equal(t, 4, inserts.events)
+
+	assert.True(t, s.RemoveListener(ctx, "db", "files", inserts))
+	assert.Len(t, s.Pipeline()[0][0].Value.(bson.D)[0].Value.(bson.A), 1)
+}
@@ -0,0 +1,64 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type txnKey struct{}
+
+// Txn identifies the transaction which produced a Change Stream event:
+// SessionID is the base64 lsid.id of the session and Number is the txnNumber of the transaction.
+type Txn struct {
+	SessionID string
+	Number    int64
+}
+
+// StreamTxn represents the transaction fields of a Change Stream event.
+// They are set only for operations which are part of a multi-document transaction.
+type StreamTxn struct {
+	LSID *struct {
+		ID struct {
+			Binary struct {
+				Base64 string `json:"base64"`
+			} `json:"$binary"`
+		} `json:"id"`
+	} `json:"lsid" bson:"lsid"`
+	TxnNumber *int64 `json:"txnNumber" bson:"txnNumber"`
+}
+
+// Txn returns the transaction of the event; found is false for events outside a transaction.
+func (s StreamTxn) Txn() (txn Txn, found bool) {
+	if s.LSID == nil || s.TxnNumber == nil || s.LSID.ID.Binary.Base64 == "" {
+		return
+	}
+	return Txn{SessionID: s.LSID.ID.Binary.Base64, Number: *s.TxnNumber}, true
+}
+
+// SessionID returns the identifier of a session as reported in the lsid of Change Stream events.
+// id is the session ID document returned by mongo.Session.ID.
+func SessionID(id bson.Raw) string {
+	v, err := id.LookupErr("id")
+	if err != nil {
+		return ""
+	}
+	_, data, ok := v.BinaryOK()
+	if !ok {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// WithTxn returns a copy of ctx carrying the transaction of a Change Stream event.
+// The Listener passes it to the handler, so listeners can match events to the transaction that produced them.
+func WithTxn(ctx context.Context, txn Txn) context.Context {
+	return context.WithValue(ctx, txnKey{}, txn)
+}
+
+// TxnFromContext returns the transaction of the Change Stream event being processed, if any.
+func TxnFromContext(ctx context.Context) (txn Txn, found bool) {
+	txn, found = ctx.Value(txnKey{}).(Txn)
+	return
+}
@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Update builds an update document from field operators ($set, $unset, $inc, $min, $max, $push,
+// $addToSet, $pull, $currentDate). The operators are applied atomically by the server,
+// so counters and arrays are changed without a read-modify-write race.
+// Fields are named by their bson names; nested fields use dotted paths.
+type Update struct {
+	ops bson.D
+}
+
+// NewUpdate creates an empty update.
+func NewUpdate() *Update {
+	return &Update{}
+}
+
+// Set sets the field to the value.
+func (u *Update) Set(field string, value any) *Update {
+	return u.op("$set", field, value)
+}
+
+// Unset removes the field.
+func (u *Update) Unset(field string) *Update {
+	return u.op("$unset", field, "")
+}
+
+// Inc increments the field by delta (a negative delta decrements it).
+func (u *Update) Inc(field string, delta any) *Update {
+	return u.op("$inc", field, delta)
+}
+
+// Min sets the field to the value if the value is less than the current one.
+func (u *Update) Min(field string, value any) *Update {
+	return u.op("$min", field, value)
+}
+
+// Max sets the field to the value if the value is greater than the current one.
+func (u *Update) Max(field string, value any) *Update {
+	return u.op("$max", field, value)
+}
+
+// Push appends the values to the array field.
+func (u *Update) Push(field string, values ...any) *Update {
+	return u.op("$push", field, each(values))
+}
+
+// AddToSet appends the values which are not in the array field yet.
+func (u *Update) AddToSet(field string, values ...any) *Update {
+	return u.op("$addToSet", field, each(values))
+}
+
+// Pull removes the elements of the array field which are equal to the value
+// or match it, if it is a condition (e.g. bson.M{"$gte": 6}).
+func (u *Update) Pull(field string, value any) *Update {
+	return u.op("$pull", field, value)
+}
+
+// CurrentDate sets the field to the current date of the server.
+func (u *Update) CurrentDate(field string) *Update {
+	return u.op("$currentDate", field, true)
+}
+
+// IsEmpty reports whether the update has no operators.
+func (u *Update) IsEmpty() bool {
+	return u == nil || len(u.ops) == 0
+}
+
+// Document returns the update document with the version field set to version, as Updater.UpdateOne does.
+func (u *Update) Document(version int64) bson.D {
+	doc := make(bson.D, 0, len(u.ops)+1)
+	hasSet := false
+	for _, op := range u.ops {
+		fields := append(bson.D{}, op.Value.(bson.D)...)
+		if op.Key == "$set" {
+			fields = setVersion(fields, version)
+			hasSet = true
+		}
+		doc = append(doc, bson.E{Key: op.Key, Value: fields})
+	}
+	if !hasSet {
+		doc = append(doc, bson.E{Key: "$set", Value: bson.D{{Key: "version", Value: version}}})
+	}
+	return doc
+}
+
+func (u *Update) op(operator, field string, value any) *Update {
+	for k, op := range u.ops {
+		if op.Key == operator {
+			u.ops[k].Value = append(op.Value.(bson.D), bson.E{Key: field, Value: value})
+			return u
+		}
+	}
+	u.ops = append(u.ops, bson.E{Key: operator, Value: bson.D{{Key: field, Value: value}}})
+	return u
+}
+
+// each wraps several values for $push and $addToSet.
+func each(values []any) any {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return bson.D{{Key: "$each", Value: values}}
+}
@@ -0,0 +1,44 @@
+package mongo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+func TestUpdate_Document(t *testing.T) {
+	assert.True(t, mongo.NewUpdate().IsEmpty())
+
+	u := mongo.NewUpdate().
+		Inc("count", 1).
+		Max("score", 10).
+		Push("tags", "a").
+		AddToSet("labels", "x", "y").
+		Pull("sizes", bson.M{"$gte": 6}).
+		CurrentDate("updatedAt").
+		Inc("total", -2)
+	assert.False(t, u.IsEmpty())
+	assert.Equal(t, bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}, {Key: "total", Value: -2}}},
+		{Key: "$max", Value: bson.D{{Key: "score", Value: 10}}},
+		{Key: "$push", Value: bson.D{{Key: "tags", Value: "a"}}},
+		{Key: "$addToSet", Value: bson.D{{Key: "labels", Value: bson.D{{Key: "$each", Value: []any{"x", "y"}}}}}},
+		{Key: "$pull", Value: bson.D{{Key: "sizes", Value: bson.M{"$gte": 6}}}},
+		{Key: "$currentDate", Value: bson.D{{Key: "updatedAt", Value: true}}},
+		{Key: "$set", Value: bson.D{{Key: "version", Value: int64(7)}}},
+	}, u.Document(7))
+
+	// the version is added to an existing $set, which is not modified by Document
+	u = mongo.NewUpdate().Set("name", name1).Unset("number")
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "name", Value: name1}, {Key: "version", Value: int64(7)}}},
+		{Key: "$unset", Value: bson.D{{Key: "number", Value: ""}}},
+	}, u.Document(7))
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "name", Value: name1}, {Key: "version", Value: int64(8)}}},
+		{Key: "$unset", Value: bson.D{{Key: "number", Value: ""}}},
+	}, u.Document(8))
+}
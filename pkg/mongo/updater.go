@@ -29,6 +29,13 @@ type Updater struct {
 // 3. Attempt to update data with version 1
 // 4. If it fails (version has advanced), get the data again with the new version, for example 3, and attempt to write it
 func (s *Updater) UpdateOne(ctx context.Context, id string, version *int64, set bson.D, unset bson.D) (found bool, err error) {
+	return s.UpdateOneIf(ctx, id, version, nil, set, unset)
+}
+
+// UpdateOneIf updates a document as UpdateOne does, if it also matches the condition:
+// a filter on its fields, e.g. bson.D{{Key: "status", Value: "pending"}}.
+// found is false when the document does not exist, does not match the condition or its version has advanced.
+func (s *Updater) UpdateOneIf(ctx context.Context, id string, version *int64, cond bson.D, set bson.D, unset bson.D) (found bool, err error) {
 	if set == nil && unset == nil {
 		return
 	}
@@ -52,6 +59,7 @@ func (s *Updater) UpdateOne(ctx context.Context, id string, version *int64, set
 	if version != nil {
 		filter = append(filter, bson.E{Key: "version", Value: *version})
 	}
+	filter = append(filter, cond...)
 	if unset != nil {
 		update = append(update, bson.E{Key: "$unset", Value: unset})
 	}
@@ -67,6 +75,54 @@ func (s *Updater) UpdateOne(ctx context.Context, id string, version *int64, set
 	return
 }
 
+// UpdateOps applies the field operators of the update to a document and bumps its version.
+// If version is set, the document is updated only if it has this version.
+// found reports whether the document was matched. ErrNothingToUpdate is returned for an empty update.
+func (s *Updater) UpdateOps(ctx context.Context, id string, version *int64, u *Update) (found bool, err error) {
+	if u.IsEmpty() {
+		return false, ErrNothingToUpdate
+	}
+	collection := s.client.Database(s.db).Collection(s.collection)
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+	filter := bson.D{{Key: "_id", Value: _id}}
+	if version != nil {
+		filter = append(filter, bson.E{Key: "version", Value: *version})
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
+	defer cancel()
+	opts := options.Update()
+	opts.Upsert = &boolFalse
+	result, err := collection.UpdateOne(ctx, filter, u.Document(time.Now().UnixNano()), opts)
+	if err != nil {
+		return
+	}
+	found = result.MatchedCount == 1
+	return
+}
+
+// UpdateMany sets the fields of all the documents matching the filter and bumps their version.
+// matched is the number of matched documents.
+func (s *Updater) UpdateMany(ctx context.Context, filter interface{}, set bson.D) (matched int, err error) {
+	if len(set) == 0 {
+		return 0, ErrNothingToUpdate
+	}
+	collection := s.client.Database(s.db).Collection(s.collection)
+	update := bson.D{{Key: "$set", Value: setVersion(append(bson.D(nil), set...), time.Now().UnixNano())}}
+	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
+	defer cancel()
+	opts := options.Update()
+	opts.Upsert = &boolFalse
+	result, err := collection.UpdateMany(ctx, filter, update, opts)
+	if err != nil {
+		return
+	}
+	matched = int(result.MatchedCount)
+	return
+}
+
 // NewUpdater creates a new Updater instance for the specified database and collection.
 func NewUpdater(client *mongo.Client, db string, collection string, connectionTimeout time.Duration) *Updater {
 	return &Updater{
@@ -7,6 +7,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Upsert handles upsert operations (insert or update) in MongoDB.
@@ -38,6 +39,46 @@ func (s *Upsert) UpsertOne(ctx context.Context, id string, doc interface{}) (err
 	return
 }
 
+// Upsert creates or updates a document by ID, managing its version as Creator.Create and Updater.UpdateOne do.
+// If version is set, the document is only updated if it exists with this version, otherwise ErrNotFound is returned;
+// it is never inserted. If version is nil, the document is only inserted with the fields of set (unset is ignored):
+// an existing document is left as it is and ErrPreconditionFailed is returned.
+// created reports whether the document was inserted.
+func (s *Upsert) Upsert(ctx context.Context, id string, version *int64, set bson.D, unset bson.D) (created bool, err error) {
+	collection := s.client.Database(s.db).Collection(s.collection)
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+	filter := bson.D{{Key: "_id", Value: _id}}
+	var update bson.D
+	if version != nil {
+		filter = append(filter, bson.E{Key: "version", Value: *version})
+		update = bson.D{{Key: "$set", Value: setVersion(set, time.Now().UnixNano())}}
+		if len(unset) > 0 {
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+	} else {
+		update = bson.D{{Key: "$setOnInsert", Value: setVersion(set, time.Now().UnixNano())}}
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
+	defer cancel()
+	res, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(version == nil))
+	if err != nil {
+		return
+	}
+	if version != nil && res.MatchedCount == 0 {
+		err = ErrNotFound
+		return
+	}
+	if version == nil && res.UpsertedCount == 0 {
+		err = ErrPreconditionFailed
+		return
+	}
+	created = res.UpsertedCount == 1
+	return
+}
+
 // UpsertMany upserts multiple documents in a single bulk operation.
 // The ids and set slices must have the same length, where ids[i] corresponds to set[i].
 func (s *Upsert) UpsertMany(ctx context.Context, ids []string, set []interface{}) (err error) {
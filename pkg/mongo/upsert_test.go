@@ -0,0 +1,68 @@
+package mongo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type fakeUpserter struct {
+	id       string
+	version  *int64
+	set      bson.D
+	existing map[string]bool
+}
+
+func (f *fakeUpserter) Upsert(ctx context.Context, id string, version *int64, set bson.D, unset bson.D) (bool, error) {
+	f.id, f.version, f.set = id, version, set
+	if version == nil && f.existing[id] {
+		return false, mongo.ErrPreconditionFailed
+	}
+	return version == nil, nil
+}
+
+func (f *fakeUpserter) UpsertOne(ctx context.Context, id string, doc interface{}) error {
+	return nil
+}
+
+func (f *fakeUpserter) UpsertMany(ctx context.Context, ids []string, set []interface{}) error {
+	return nil
+}
+
+func TestProcessor_Upsert(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*V](map[string]*V{})
+	p := mongo.NewProcessor[*V](c, nil, nil, nil)
+	u := &fakeUpserter{}
+	p.SetUpserter(u)
+
+	// not cached: all the fields are written without the _id and without a version condition
+	v := &V{PName: name1}
+	created, err := p.Upsert(ctx, v)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, v.ID(), u.id)
+	assert.Nil(t, u.version)
+	for _, e := range u.set {
+		assert.NotEqual(t, "_id", e.Key)
+	}
+
+	// not cached but existing (e.g. filtered out or soft-deleted): not overwritten
+	u.existing = map[string]bool{v.ID(): true}
+	_, err = p.Upsert(ctx, &V{D: D{Id: v.Id}, PName: name2})
+	assert.ErrorIs(t, err, mongo.ErrPreconditionFailed)
+
+	// cached: only the changes are written with the cached version
+	c.Add(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: name1})
+	_, err = p.Upsert(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: name1})
+	assert.ErrorIs(t, err, mongo.ErrNothingToUpdate)
+	created, err = p.Upsert(ctx, &V{D: D{Id: v.Id, V: &version1}, PName: "changed"})
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, version1, *u.version)
+}
@@ -0,0 +1,238 @@
+package mongo
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ValidationError describes a field which breaks a rule of its validate tag.
+type ValidationError struct {
+	Field string // bson path of the field, e.g. address.city or items.0.count
+	Rule  string // the rule as written in the tag, e.g. min=1
+	Value any
+}
+
+// Error ...
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s (value %v)", e.Field, e.Rule, e.Value)
+}
+
+// ValidationErrors is returned by Validate and by the Processor for an entity which breaks its validate rules.
+type ValidationErrors []ValidationError
+
+// Error ...
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ve := range e {
+		msgs[i] = ve.Error()
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the entity against the validate tags of its fields, nested structs and slices included.
+// Rules are separated by commas:
+//   - required: a pointer is not nil, other values are not zero
+//   - min=N, max=N: bounds of a number, or of the length of a string, slice or map
+//   - len=N: the exact length of a string, slice or map
+//   - regex=EXPR: a string matches the expression (which can not contain commas)
+//   - enum=A|B|C: the value, formatted with %v, is one of the listed ones
+//   - objectid: a string is an ObjectID hex
+//
+// Rules other than required are not checked for nil pointers. Returns ValidationErrors or nil.
+func Validate(v any) error {
+	var errs ValidationErrors
+	validateValue(reflect.ValueOf(v), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type validateRule struct {
+	text  string
+	name  string
+	arg   string
+	num   float64
+	re    *regexp.Regexp
+	enums []string
+}
+
+var (
+	validateRules   sync.Map // map[string][]validateRule
+	objectIDPattern = regexp.MustCompile("^[0-9a-fA-F]{24}$")
+)
+
+func parseValidateTag(tag string) (rules []validateRule, err error) {
+	if cached, ok := validateRules.Load(tag); ok {
+		return cached.([]validateRule), nil
+	}
+	for _, text := range strings.Split(tag, ",") {
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		r := validateRule{text: text, name: text}
+		if i := strings.Index(text, "="); i >= 0 {
+			r.name, r.arg = text[:i], text[i+1:]
+		}
+		switch r.name {
+		case "required", "objectid":
+		case "min", "max", "len":
+			if r.num, err = strconv.ParseFloat(r.arg, 64); err != nil {
+				return nil, fmt.Errorf("validate tag %q: %w", tag, err)
+			}
+		case "regex":
+			if r.re, err = regexp.Compile(r.arg); err != nil {
+				return nil, fmt.Errorf("validate tag %q: %w", tag, err)
+			}
+		case "enum":
+			r.enums = strings.Split(r.arg, "|")
+		default:
+			return nil, fmt.Errorf("validate tag %q: unknown rule %s", tag, r.name)
+		}
+		rules = append(rules, r)
+	}
+	validateRules.Store(tag, rules)
+	return
+}
+
+func validateValue(v reflect.Value, path string, errs *ValidationErrors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			ft := t.Field(i)
+			if !ft.IsExported() {
+				continue
+			}
+			key := strings.Split(ft.Tag.Get("bson"), ",")[0]
+			if key == "-" {
+				continue
+			}
+			fieldPath := path
+			if key != "" {
+				fieldPath = joinPath(path, key)
+			}
+			fv := v.Field(i)
+			if tag, ok := ft.Tag.Lookup("validate"); ok {
+				validateField(fv, fieldPath, tag, errs)
+			}
+			validateValue(fv, fieldPath, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), joinPath(path, strconv.Itoa(i)), errs)
+		}
+	}
+}
+
+func validateField(v reflect.Value, path, tag string, errs *ValidationErrors) {
+	rules, err := parseValidateTag(tag)
+	if err != nil {
+		*errs = append(*errs, ValidationError{Field: path, Rule: tag, Value: err.Error()})
+		return
+	}
+	for _, r := range rules {
+		if r.name == "required" {
+			if isZero(v) {
+				*errs = append(*errs, ValidationError{Field: path, Rule: r.text, Value: nil})
+			}
+			continue
+		}
+		ev := v
+		for ev.Kind() == reflect.Ptr || ev.Kind() == reflect.Interface {
+			if ev.IsNil() {
+				break
+			}
+			ev = ev.Elem()
+		}
+		if (ev.Kind() == reflect.Ptr || ev.Kind() == reflect.Interface) && ev.IsNil() {
+			continue
+		}
+		if !r.check(ev) {
+			*errs = append(*errs, ValidationError{Field: path, Rule: r.text, Value: ev.Interface()})
+		}
+	}
+}
+
+func (r validateRule) check(v reflect.Value) bool {
+	switch r.name {
+	case "min", "max", "len":
+		n, ok := measure(v, r.name == "len")
+		if !ok {
+			return false
+		}
+		switch r.name {
+		case "min":
+			return n >= r.num
+		case "max":
+			return n <= r.num
+		}
+		return n == r.num
+	case "regex":
+		return v.Kind() == reflect.String && r.re.MatchString(v.String())
+	case "enum":
+		s := fmt.Sprint(v.Interface())
+		for _, e := range r.enums {
+			if e == s {
+				return true
+			}
+		}
+		return false
+	case "objectid":
+		if _, ok := v.Interface().(primitive.ObjectID); ok {
+			return true
+		}
+		return v.Kind() == reflect.String && objectIDPattern.MatchString(v.String())
+	}
+	return true
+}
+
+// measure returns a number or, if it is a string, slice or map (or length is requested), its length.
+func measure(v reflect.Value, length bool) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	}
+	if length {
+		return 0, false
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
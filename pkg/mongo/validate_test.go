@@ -0,0 +1,91 @@
+package mongo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dhlab-tech/go-mongo-platform/pkg/inmemory"
+	"github.com/dhlab-tech/go-mongo-platform/pkg/mongo"
+)
+
+type Line struct {
+	Qty int `bson:"qty" validate:"min=1"`
+}
+
+type Product struct {
+	D
+	Name   *string `bson:"name" validate:"required,min=2"`
+	Count  int     `bson:"count" validate:"max=10"`
+	Code   string  `bson:"code" validate:"len=3,regex=^[A-Z]+$"`
+	Status string  `bson:"status" validate:"enum=pending|done"`
+	Parent *string `bson:"parent" validate:"objectid"`
+	Lines  []Line  `bson:"lines"`
+}
+
+func TestValidate(t *testing.T) {
+	name, short, parent, bad := "name", "n", "5f1b2c3d4e5f6a7b8c9d0e1f", "parent"
+	valid := &Product{Name: &name, Count: 10, Code: "ABC", Status: "done", Parent: &parent, Lines: []Line{{Qty: 1}}}
+	assert.NoError(t, mongo.Validate(valid))
+	assert.NoError(t, mongo.Validate(&Product{Name: &name, Code: "XYZ", Status: "pending"}))
+
+	err := mongo.Validate(&Product{Count: 11, Code: "abcd", Status: "new", Parent: &bad, Lines: []Line{{Qty: 1}, {}}})
+	var errs mongo.ValidationErrors
+	assert.ErrorAs(t, err, &errs)
+	assert.Equal(t, mongo.ValidationErrors{
+		{Field: "name", Rule: "required"},
+		{Field: "count", Rule: "max=10", Value: 11},
+		{Field: "code", Rule: "len=3", Value: "abcd"},
+		{Field: "code", Rule: "regex=^[A-Z]+$", Value: "abcd"},
+		{Field: "status", Rule: "enum=pending|done", Value: "new"},
+		{Field: "parent", Rule: "objectid", Value: bad},
+		{Field: "lines.1.qty", Rule: "min=1", Value: 0},
+	}, errs)
+
+	err = mongo.Validate(&Product{Name: &short, Code: "ABC", Status: "done"})
+	assert.Equal(t, mongo.ValidationErrors{{Field: "name", Rule: "min=2", Value: short}}, err)
+}
+
+func TestProcessor_Validate(t *testing.T) {
+	ctx := context.Background()
+	c := inmemory.NewCache[*Product](map[string]*Product{})
+	p := mongo.NewProcessor[*Product](c, nil, nil, nil)
+	name := "name"
+
+	_, _, err := p.PrepareCreate(ctx, &Product{Code: "ABC", Status: "done"})
+	assert.Equal(t, mongo.ValidationErrors{{Field: "name", Rule: "required"}}, err)
+
+	// an update is checked against the resulting entity
+	v := &Product{D: D{V: &version1}, Name: &name, Code: "ABC", Status: "done"}
+	c.Add(ctx, v)
+	_, _, _, err = p.PrepareUpdate(ctx, &Product{D: D{Id: v.Id, V: &version1}, Name: &name, Code: "ABC", Status: "done", Count: 5})
+	assert.NoError(t, err)
+	_, _, _, err = p.PrepareUpdate(ctx, &Product{D: D{Id: v.Id, V: &version1}, Name: &name, Code: "ABC", Status: "new"})
+	assert.Equal(t, mongo.ValidationErrors{{Field: "status", Rule: "enum=pending|done", Value: "new"}}, err)
+
+	// the changes of the BeforeUpdate hook are validated
+	p.SetHooks(mongo.Hooks[*Product]{BeforeUpdate: func(ctx context.Context, current, ps *Product, set, unset bson.D) (bson.D, bson.D, error) {
+		for i, e := range set {
+			if e.Key == "status" {
+				set[i].Value = "done"
+			}
+		}
+		return set, append(unset, bson.E{Key: "name", Value: ""}), nil
+	}})
+	_, _, _, err = p.PrepareUpdate(ctx, &Product{D: D{Id: v.Id, V: &version1}, Name: &name, Code: "ABC", Status: "new"})
+	assert.Equal(t, mongo.ValidationErrors{{Field: "name", Rule: "required"}}, err)
+
+	// the changes of the BeforeCreate hook are validated
+	p.SetHooks(mongo.Hooks[*Product]{BeforeCreate: func(ctx context.Context, ps *Product, doc bson.D) (bson.D, error) {
+		for i, e := range doc {
+			if e.Key == "status" {
+				doc[i].Value = "new"
+			}
+		}
+		return doc, nil
+	}})
+	_, _, err = p.PrepareCreate(ctx, &Product{Name: &name, Code: "ABC", Status: "done"})
+	assert.Equal(t, mongo.ValidationErrors{{Field: "status", Rule: "enum=pending|done", Value: "new"}}, err)
+}
@@ -0,0 +1,121 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Watch scopes of a Stream opening its own Change Streams (see SetClient).
+const (
+	// WatchAuto watches the database of the listeners, or the whole cluster when they are in several databases
+	// when Listen starts.
+	WatchAuto = ""
+	// WatchDatabases opens a Change Stream per database of the listeners.
+	WatchDatabases = "databases"
+	// WatchCluster opens a single cluster-wide Change Stream.
+	WatchCluster = "cluster"
+)
+
+// SetClient makes the Stream open and own its Change Streams, chosen from the databases of the registered
+// listeners: one per database or one cluster-wide Change Stream, depending on the scope (WatchAuto by default).
+// Each Change Stream has a pipeline built from the listeners of its databases (see Pipeline) and is reopened,
+// resuming after its last event, when they change. Change Streams are opened and closed by Listen
+// as databases gain or lose listeners; a new Change Stream starts at the current time, unless opts says otherwise,
+// so listeners of new databases should be registered before Listen when no event may be missed.
+// The scope is fixed once Listen watches the first listeners: a running Change Stream is never replaced by one
+// of another scope, which would miss the events in between (WatchAuto then opens a Change Stream per database
+// for the databases which gain listeners later). A new scope or client applies to the next Listen.
+// It takes precedence over SetChange and SetWatcher.
+func (s *Stream) SetClient(client *mongo.Client, scope string, opts ...*options.ChangeStreamOptions) {
+	s.Lock()
+	defer s.Unlock()
+	s.client = client
+	s.scope = scope
+	s.opts = opts
+	s.notify()
+}
+
+// resolveScope resolves WatchAuto from the number of databases of the listeners; it stays unresolved while there are none.
+func resolveScope(scope string, dbs int) string {
+	if scope != WatchAuto {
+		return scope
+	}
+	switch dbs {
+	case 0:
+		return WatchAuto
+	case 1:
+		return WatchDatabases
+	}
+	return WatchCluster
+}
+
+// watchers returns the Change Streams of the scope to open for the registered listeners: their watchers by database,
+// the empty database standing for the cluster.
+func (s *Stream) watchers(client *mongo.Client, scope string) map[string]Watcher {
+	dbs := sortedKeys(s.listeners)
+	watchers := map[string]Watcher{}
+	if len(dbs) == 0 {
+		return watchers
+	}
+	if scope == WatchCluster {
+		watchers[""] = client
+		return watchers
+	}
+	for _, db := range dbs {
+		watchers[db] = client.Database(db)
+	}
+	return watchers
+}
+
+// listenClient listens to the Change Streams of the client, opening and closing them as listeners change,
+// until one of them fails or the context is done. The scope is resolved once, when there are listeners to watch.
+func (s *Stream) listenClient(ctx context.Context, client *mongo.Client, scope string) (err error) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failed := make(chan error, 1)
+	running := map[string]context.CancelFunc{}
+	for {
+		s.RLock()
+		scope = resolveScope(scope, len(s.listeners))
+		watchers := s.watchers(client, scope)
+		changed := s.changed
+		s.RUnlock()
+		for db, stop := range running {
+			if _, ok := watchers[db]; !ok {
+				stop()
+				delete(running, db)
+			}
+		}
+		for db, watcher := range watchers {
+			if _, ok := running[db]; ok {
+				continue
+			}
+			wctx, stop := context.WithCancel(ctx)
+			running[db] = stop
+			wg.Add(1)
+			go func(w *watchedStream) {
+				defer wg.Done()
+				if e := s.listen(wctx, w); e != nil && wctx.Err() == nil {
+					select {
+					case failed <- e:
+					default:
+					}
+				}
+			}(&watchedStream{db: db, watcher: watcher})
+			zerolog.Ctx(ctx).Debug().Str("db", db).Msg("change stream started")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err = <-failed:
+			return
+		case <-changed:
+		}
+	}
+}
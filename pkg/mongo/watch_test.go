@@ -0,0 +1,53 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestStream_Watchers(t *testing.T) {
+	ctx := context.Background()
+	// The client does not connect until it is used.
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err)
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	s := NewStream(nil, map[string]map[string]StreamListener{})
+	s.SetClient(client, WatchAuto)
+	assert.Equal(t, WatchAuto, resolveScope(WatchAuto, len(s.listeners)))
+	assert.Empty(t, s.watchers(client, WatchAuto))
+
+	a, b := &recordingListener{}, &recordingListener{}
+	s.AddListener(ctx, "a", "files", a)
+	scope := resolveScope(WatchAuto, len(s.listeners))
+	watchers := s.watchers(client, scope)
+	assert.Len(t, watchers, 1)
+	assert.Equal(t, "a", watchers["a"].(*mongo.Database).Name())
+
+	// A resolved scope is kept: the new database gets its own Change Stream.
+	s.AddListener(ctx, "b", "files", b)
+	assert.Len(t, s.watchers(client, resolveScope(scope, len(s.listeners))), 2)
+
+	watchers = s.watchers(client, resolveScope(WatchAuto, len(s.listeners)))
+	assert.Len(t, watchers, 1)
+	assert.Same(t, client, watchers[""])
+
+	// The pipeline of a database only matches the events of its listeners.
+	or := s.pipeline("b")[0][0].Value.(bson.D)[0].Value.(bson.A)
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "operationType", Value: InvalidateOperationType}},
+		bson.D{{Key: "operationType", Value: DropDatabaseOperationType}, {Key: "ns.db", Value: "b"}},
+		bson.D{{Key: "ns.db", Value: "b"}, {Key: "ns.coll", Value: "files"}},
+	}, or)
+
+	// An invalidate event of a database Change Stream only reaches the listeners of the database.
+	invalidate := StreamingNS{OperationType: InvalidateOperationType}
+	assert.Equal(t, []StreamListener{b}, s.targets("b", invalidate))
+	assert.Equal(t, []StreamListener{a, b}, s.targets("", invalidate))
+}
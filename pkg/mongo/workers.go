@@ -0,0 +1,117 @@
+package mongo
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Orderings of the events processed in parallel by a Stream (see StreamWorkers).
+const (
+	// OrderByDocument keeps the order of the events of each document: events are sharded by namespace and documentKey.
+	OrderByDocument = "document"
+	// OrderByCollection keeps the order of the events of each collection: events are sharded by namespace.
+	OrderByCollection = "collection"
+)
+
+// StreamWorkers configures the parallel processing of the events of a Stream.
+type StreamWorkers struct {
+	Workers  int    // number of workers, each with an ordered queue; 1 or less processes events on the Listen goroutine
+	Capacity int    // capacity of the queue of each worker, 256 by default; a full queue blocks the Change Stream
+	Order    string // OrderByDocument (default) or OrderByCollection
+}
+
+// SetWorkers makes Listen dispatch the events of its single Change Stream to parallel workers with ordered queues,
+// so a heavy collection does not delay the events of the others. Events with the same ordering key are always
+// dispatched by the same worker, in order. Collection-wide events (drop, rename, dropDatabase, invalidate)
+// wait until the queued events are dispatched and are then dispatched alone.
+// It must be called before Listen.
+func (s *Stream) SetWorkers(workers StreamWorkers) {
+	if workers.Capacity <= 0 {
+		workers.Capacity = 256
+	}
+	if workers.Order == "" {
+		workers.Order = OrderByDocument
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.workers = workers
+}
+
+// streamEvent is the ordering key of an event.
+type streamEvent struct {
+	StreamingNS `bson:",inline"`
+	DocumentKey bson.Raw `bson:"documentKey"`
+}
+
+// workerPool dispatches events on sharded ordered queues.
+type workerPool struct {
+	stream  *Stream
+	db      string // database of the Change Stream, empty for every database
+	order   string
+	queues  []chan bson.Raw
+	pending sync.WaitGroup // queued events not yet dispatched
+	done    sync.WaitGroup // running workers
+}
+
+func newWorkerPool(ctx context.Context, s *Stream, db string, opts StreamWorkers) *workerPool {
+	p := &workerPool{
+		stream: s,
+		db:     db,
+		order:  opts.Order,
+		queues: make([]chan bson.Raw, opts.Workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan bson.Raw, opts.Capacity)
+		p.done.Add(1)
+		go p.work(ctx, p.queues[i])
+	}
+	return p
+}
+
+// submit queues the event on the worker of its ordering key, or dispatches it alone for collection-wide events.
+func (p *workerPool) submit(ctx context.Context, event bson.Raw) {
+	var e streamEvent
+	err := bson.Unmarshal(event, &e)
+	if err != nil || e.NS.Coll == "" || (p.order == OrderByDocument && e.DocumentKey == nil) {
+		// Collection-wide and undecodable events are barriers.
+		p.pending.Wait()
+		p.stream.process(ctx, p.db, event)
+		return
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.NS.Db + "." + e.NS.Coll))
+	if p.order == OrderByDocument {
+		_, _ = h.Write(e.DocumentKey)
+	}
+	p.pending.Add(1)
+	// The event is copied, since the Change Stream reuses its buffer.
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- append(bson.Raw(nil), event...)
+}
+
+func (p *workerPool) work(ctx context.Context, queue chan bson.Raw) {
+	defer p.done.Done()
+	for event := range queue {
+		p.stream.process(ctx, p.db, event)
+		p.pending.Done()
+	}
+}
+
+// close waits until the queued events are dispatched and stops the workers.
+func (p *workerPool) close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.done.Wait()
+}
+
+// process dispatches an event of a Change Stream of the database, logging and quarantining it if the dispatch fails.
+func (s *Stream) process(ctx context.Context, db string, event bson.Raw) {
+	if err := s.dispatch(ctx, db, event); err != nil {
+		logWithError(zerolog.Ctx(ctx), jsonEvent(event), err, "processing stream")
+		s.quarantine(ctx, db, event, err)
+	}
+}
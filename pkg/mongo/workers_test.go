@@ -0,0 +1,87 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// recordingListener records the document IDs of its events, slowly for the slow collection.
+type recordingListener struct {
+	mu     sync.Mutex
+	delay  time.Duration
+	events []string
+}
+
+func (l *recordingListener) Listen(ctx context.Context, change []byte) (err error) {
+	time.Sleep(l.delay)
+	var e struct {
+		OperationType string `json:"operationType"`
+		DocumentKey   struct {
+			ID string `json:"_id"`
+		} `json:"documentKey"`
+	}
+	if err = json.Unmarshal(change, &e); err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e.OperationType+":"+e.DocumentKey.ID)
+	return
+}
+
+func (l *recordingListener) recorded() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+func streamEventOf(t *testing.T, op, col, id string) bson.Raw {
+	doc := bson.D{
+		{Key: "operationType", Value: op},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "db"}, {Key: "coll", Value: col}}},
+	}
+	if id != "" {
+		doc = append(doc, bson.E{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}})
+	}
+	b, err := bson.Marshal(doc)
+	require.NoError(t, err)
+	return b
+}
+
+func TestWorkerPool(t *testing.T) {
+	ctx := context.Background()
+	slow := &recordingListener{delay: 20 * time.Millisecond}
+	fast := &recordingListener{}
+	s := NewStream(nil, map[string]map[string]StreamListener{})
+	s.AddListener(ctx, "db", "slow", slow)
+	s.AddListener(ctx, "db", "fast", fast)
+	pool := newWorkerPool(ctx, s, "", StreamWorkers{Workers: 4, Capacity: 16, Order: OrderByDocument})
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		op := UpdateOperationType
+		if i == 0 {
+			op = InsertOperationType
+		}
+		pool.submit(ctx, streamEventOf(t, op, "slow", "a"))
+		want = append(want, op+":a")
+	}
+	pool.submit(ctx, streamEventOf(t, InsertOperationType, "fast", "b"))
+	// The fast collection is not delayed by the queued events of the slow one.
+	assert.Eventually(t, func() bool {
+		return len(fast.recorded()) == 1
+	}, 100*time.Millisecond, time.Millisecond)
+	assert.Less(t, len(slow.recorded()), 10)
+
+	// A collection-wide event waits for the queued events.
+	pool.submit(ctx, streamEventOf(t, DropOperationType, "slow", ""))
+	assert.Equal(t, append(want, DropOperationType+":"), slow.recorded())
+	pool.close()
+}